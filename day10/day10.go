@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
 	"os"
 	"strconv"
@@ -11,8 +12,20 @@ import (
 type MicroopType int
 
 const (
-	Noop MicroopType = iota
+	Stall MicroopType = iota
+	Noop
 	AddX
+	Mov
+	Add
+	Sub
+	Mul
+	Div
+	Mod
+	Jmp
+	Jz
+	Jnz
+	Jlt
+	Jgt
 )
 
 type Microop struct {
@@ -24,6 +37,82 @@ type AddXData struct {
 	operand int
 }
 
+type Operand struct {
+	register string
+	value    int
+}
+
+type ArithData struct {
+	target string
+	source Operand
+}
+
+type JumpData struct {
+	left   Operand
+	right  Operand
+	target int
+}
+
+type InstructionSpec struct {
+	opType   MicroopType
+	cycles   int
+	operands int
+}
+
+var instructions = map[string]InstructionSpec{
+	"noop": {Noop, 1, 0},
+	"addx": {AddX, 2, 1},
+	"mov":  {Mov, 1, 2},
+	"add":  {Add, 1, 2},
+	"sub":  {Sub, 1, 2},
+	"mul":  {Mul, 3, 2},
+	"div":  {Div, 4, 2},
+	"mod":  {Mod, 4, 2},
+	"jmp":  {Jmp, 2, 1},
+	"jz":   {Jz, 2, 2},
+	"jnz":  {Jnz, 2, 2},
+	"jlt":  {Jlt, 2, 3},
+	"jgt":  {Jgt, 2, 3},
+}
+
+// Instruction is a single line of the program. It takes cycles cycles and
+// only its last cycle has an effect, so registers read during the earlier
+// ones still hold the old values.
+type Instruction struct {
+	op     Microop
+	cycles int
+	line   int
+	text   string
+}
+
+func (ins Instruction) microops() []Microop {
+	result := make([]Microop, ins.cycles)
+	for i := range result {
+		result[i] = Microop{opType: Stall}
+	}
+	result[len(result)-1] = ins.op
+	return result
+}
+
+type CPU struct {
+	regs map[string]int
+	pc   int
+}
+
+func createCPU() CPU {
+	return CPU{
+		regs: map[string]int{"x": 1},
+		pc:   0,
+	}
+}
+
+func (cpu *CPU) value(o Operand) int {
+	if o.register != "" {
+		return cpu.regs[o.register]
+	}
+	return o.value
+}
+
 func abs(x int) int {
 	if x < 0 {
 		return -x
@@ -32,80 +121,320 @@ func abs(x int) int {
 	}
 }
 
-func parse(l string, output []Microop) []Microop {
-	data := strings.Split(l, " ")
-	if data[0] == "noop" {
-		output = append(output, Microop{opType: Noop, data: nil})
-	} else if data[0] == "addx" {
-		operand, _ := strconv.Atoi(data[1])
-		output = append(output, Microop{opType: Noop, data: nil}, Microop{opType: AddX, data: AddXData{operand: operand}})
-	} else {
-		fmt.Errorf("the instruction %v is unknown", data[0])
+func isRegister(s string) bool {
+	if s == "" {
+		return false
 	}
-	return output
+	for _, c := range s {
+		if c < 'a' || c > 'z' {
+			return false
+		}
+	}
+	return true
 }
 
-func execute(xReg int, op Microop) int {
-	if op.opType == Noop {
-		return xReg
-	} else if op.opType == AddX {
-		xData, _ := op.data.(AddXData)
-		return xReg + xData.operand
-	} else {
-		fmt.Errorf("unknown operation")
-		return 0
+func parseOperand(s string) (Operand, error) {
+	if isRegister(s) {
+		return Operand{register: s}, nil
 	}
+	value, err := strconv.Atoi(s)
+	if err != nil {
+		return Operand{}, fmt.Errorf("the operand %v is neither a register nor a number", s)
+	}
+	return Operand{value: value}, nil
+}
+
+type unresolvedJump struct {
+	index int
+	label string
 }
 
-func part1(ops []Microop) int {
-	total := 0
-	xReg := 1
+// parse reads the whole program. A line ending with a colon defines a label
+// for the next instruction, jumps name their target as the last operand.
+func parse(lines []string) ([]Instruction, error) {
+	program := make([]Instruction, 0, len(lines))
+	labels := make(map[string]int)
+	jumps := make([]unresolvedJump, 0)
+
+	for i, l := range lines {
+		data := strings.Fields(l)
+		if len(data) == 0 {
+			continue
+		}
+
+		if len(data) == 1 && strings.HasSuffix(data[0], ":") {
+			label := strings.TrimSuffix(data[0], ":")
+			if _, ok := labels[label]; ok {
+				return nil, fmt.Errorf("line %v: the label %v is defined twice", i+1, label)
+			}
+			labels[label] = len(program)
+			continue
+		}
+
+		spec, ok := instructions[data[0]]
+		if !ok {
+			return nil, fmt.Errorf("line %v: the instruction %v is unknown", i+1, data[0])
+		}
+		args := data[1:]
+		if len(args) != spec.operands {
+			return nil, fmt.Errorf("line %v: %v takes %v operands, got %v", i+1, data[0], spec.operands, len(args))
+		}
+
+		op := Microop{opType: spec.opType}
+		switch spec.opType {
+		case AddX:
+			operand, err := strconv.Atoi(args[0])
+			if err != nil {
+				return nil, fmt.Errorf("line %v: the operand %v is not a number", i+1, args[0])
+			}
+			op.data = AddXData{operand: operand}
+		case Mov, Add, Sub, Mul, Div, Mod:
+			if !isRegister(args[0]) {
+				return nil, fmt.Errorf("line %v: %v is not a register", i+1, args[0])
+			}
+			source, err := parseOperand(args[1])
+			if err != nil {
+				return nil, fmt.Errorf("line %v: %w", i+1, err)
+			}
+			op.data = ArithData{target: args[0], source: source}
+		case Jmp, Jz, Jnz, Jlt, Jgt:
+			var jump JumpData
+			var err error
+			if len(args) > 1 {
+				jump.left, err = parseOperand(args[0])
+			}
+			if err == nil && len(args) > 2 {
+				jump.right, err = parseOperand(args[1])
+			}
+			if err != nil {
+				return nil, fmt.Errorf("line %v: %w", i+1, err)
+			}
+			op.data = jump
+			jumps = append(jumps, unresolvedJump{index: len(program), label: args[len(args)-1]})
+		}
 
-	for i, op := range ops {
-		i++
+		program = append(program, Instruction{op: op, cycles: spec.cycles, line: i + 1, text: strings.Join(data, " ")})
+	}
 
-		if i == 20 || i == 60 || i == 100 || i == 140 || i == 180 || i == 220 {
-			total += i * xReg
+	for _, j := range jumps {
+		target, ok := labels[j.label]
+		if !ok {
+			return nil, fmt.Errorf("line %v: the label %v is not defined", program[j.index].line, j.label)
 		}
+		jump := program[j.index].op.data.(JumpData)
+		jump.target = target
+		program[j.index].op.data = jump
+	}
 
-		xReg = execute(xReg, op)
+	return program, nil
+}
+
+func execute(cpu *CPU, op Microop) error {
+	switch op.opType {
+	case Stall:
+		return nil
+	case Noop:
+	case AddX:
+		xData, _ := op.data.(AddXData)
+		cpu.regs["x"] += xData.operand
+	case Mov, Add, Sub, Mul, Div, Mod:
+		data, _ := op.data.(ArithData)
+		source := cpu.value(data.source)
+		if (op.opType == Div || op.opType == Mod) && source == 0 {
+			return fmt.Errorf("division by zero")
+		}
+		switch op.opType {
+		case Mov:
+			cpu.regs[data.target] = source
+		case Add:
+			cpu.regs[data.target] += source
+		case Sub:
+			cpu.regs[data.target] -= source
+		case Mul:
+			cpu.regs[data.target] *= source
+		case Div:
+			cpu.regs[data.target] /= source
+		case Mod:
+			cpu.regs[data.target] %= source
+		}
+	case Jmp, Jz, Jnz, Jlt, Jgt:
+		data, _ := op.data.(JumpData)
+		left, right := cpu.value(data.left), cpu.value(data.right)
+		taken := op.opType == Jmp ||
+			(op.opType == Jz && left == 0) ||
+			(op.opType == Jnz && left != 0) ||
+			(op.opType == Jlt && left < right) ||
+			(op.opType == Jgt && left > right)
+		if taken {
+			cpu.pc = data.target
+			return nil
+		}
+	default:
+		return fmt.Errorf("unknown operation %v", op.opType)
 	}
-	return total
+	cpu.pc++
+	return nil
 }
 
-func part2(ops []Microop) {
-	xReg := 1
+type Observer interface {
+	// observe is called at every cycle before the cycle's microop executes.
+	// Returning an error stops the program.
+	observe(cycle int, ins Instruction, cpu *CPU) error
+}
+
+type ObserverFunc func(cycle int, cpu *CPU)
+
+func (f ObserverFunc) observe(cycle int, ins Instruction, cpu *CPU) error {
+	f(cycle, cpu)
+	return nil
+}
 
-	for i, op := range ops {
-		if abs(xReg-(i%40)) <= 1 {
-			fmt.Print("#")
-		} else {
-			fmt.Print(".")
+// run executes the program until it falls off its end.
+func run(program []Instruction, maxCycles int, observer Observer) error {
+	cpu := createCPU()
+	cycle := 0
+
+	for cpu.pc >= 0 && cpu.pc < len(program) {
+		ins := program[cpu.pc]
+		for _, op := range ins.microops() {
+			cycle++
+			if cycle > maxCycles {
+				return fmt.Errorf("the program did not stop within %v cycles", maxCycles)
+			}
+
+			if err := observer.observe(cycle, ins, &cpu); err != nil {
+				return err
+			}
+			if err := execute(&cpu, op); err != nil {
+				return fmt.Errorf("line %v, cycle %v: %w", ins.line, cycle, err)
+			}
 		}
+	}
+	return nil
+}
+
+const maxCycles = 1000000
+
+var defaultSamples = []int{20, 60, 100, 140, 180, 220}
 
-		if i % 40 == 39 {
-			fmt.Println()
+type SignalProbe struct {
+	samples map[int]bool
+	total   int
+}
+
+func createSignalProbe(samples []int) SignalProbe {
+	probe := SignalProbe{samples: make(map[int]bool)}
+	for _, s := range samples {
+		probe.samples[s] = true
+	}
+	return probe
+}
+
+func (p *SignalProbe) observe(cycle int, ins Instruction, cpu *CPU) error {
+	if p.samples[cycle] {
+		p.total += cycle * cpu.regs["x"]
+	}
+	return nil
+}
+
+func part1(program []Instruction, samples []int) (int, error) {
+	probe := createSignalProbe(samples)
+	err := run(program, maxCycles, &probe)
+	return probe.total, err
+}
+
+func render(program []Instruction) (CRT, error) {
+	var crt CRT
+	err := run(program, maxCycles, ObserverFunc(func(cycle int, cpu *CPU) {
+		i := cycle - 1
+		if i >= crtWidth*crtHeight {
+			return
+		}
+		if abs(cpu.regs["x"]-(i%crtWidth)) <= 1 {
+			crt[i/crtWidth][i%crtWidth] = true
 		}
+	}))
+	return crt, err
+}
 
-		xReg = execute(xReg, op)
+func part2(program []Instruction) (string, error) {
+	crt, err := render(program)
+	if err != nil {
+		return "", err
 	}
+
+	text, err := decode(&crt)
+	if err != nil {
+		return text, fmt.Errorf("%w, the screen shows:\n%v", err, strings.TrimSuffix(crt.String(), "\n"))
+	}
+	return text, nil
+}
+
+func parseSamples(spec string) ([]int, error) {
+	result := make([]int, 0)
+	for _, s := range strings.Split(spec, ",") {
+		cycle, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil || cycle <= 0 {
+			return nil, fmt.Errorf("the sample point %v is not a cycle number", s)
+		}
+		result = append(result, cycle)
+	}
+	return result, nil
 }
 
 func main() {
+	samplesSpec := flag.String("samples", "", "comma separated cycles sampled for part 1")
+	debug := flag.Bool("debug", false, "run the program in the interactive debugger")
+	flag.Parse()
+
+	samples := defaultSamples
+	if *samplesSpec != "" {
+		var err error
+		samples, err = parseSamples(*samplesSpec)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+
 	readFile, err := os.Open("data.txt")
 
 	if err != nil {
 		fmt.Println(err)
+		return
 	}
 	fileScanner := bufio.NewScanner(readFile)
 	fileScanner.Split(bufio.ScanLines)
 
-	ops := make([]Microop, 0)
-
+	lines := make([]string, 0)
 	for fileScanner.Scan() {
-		ops = parse(fileScanner.Text(), ops)
+		lines = append(lines, fileScanner.Text())
+	}
+
+	program, err := parse(lines)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	if *debug {
+		debugger := createDebugger(os.Stdin, os.Stdout)
+		if err := run(program, maxCycles, &debugger); err != nil {
+			fmt.Println(err)
+		}
+		return
+	}
+
+	total, err := part1(program, samples)
+	if err != nil {
+		fmt.Println(err)
+		return
 	}
+	fmt.Println("Part 1: ", total)
 
-	fmt.Println("Part 1: ", part1(ops))
-	part2(ops)
+	text, err := part2(program)
+	if err != nil {
+		fmt.Println(err)
+	}
+	fmt.Println("Part 2: ", text)
 }
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var errQuit = errors.New("stopped by the debugger")
+
+type RegisterBreak struct {
+	register string
+	value    int
+}
+
+// Debugger pauses the program before a cycle executes, either after a number
+// of steps, at a cycle breakpoint or when a register takes a watched value.
+type Debugger struct {
+	in          *bufio.Scanner
+	out         io.Writer
+	steps       int
+	running     bool
+	cycleBreaks map[int]bool
+	regBreaks   map[RegisterBreak]bool
+	matched     map[RegisterBreak]bool
+}
+
+func createDebugger(in io.Reader, out io.Writer) Debugger {
+	return Debugger{
+		in:          bufio.NewScanner(in),
+		out:         out,
+		steps:       1,
+		cycleBreaks: make(map[int]bool),
+		regBreaks:   make(map[RegisterBreak]bool),
+		matched:     make(map[RegisterBreak]bool),
+	}
+}
+
+func (d *Debugger) printState(cycle int, ins Instruction, cpu *CPU) {
+	names := make([]string, 0, len(cpu.regs))
+	for name := range cpu.regs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	regs := make([]string, len(names))
+	for i, name := range names {
+		regs[i] = fmt.Sprintf("%v=%v", name, cpu.regs[name])
+	}
+	fmt.Fprintf(d.out, "cycle %v, line %v: %v [%v]\n", cycle, ins.line, ins.text, strings.Join(regs, " "))
+}
+
+// hitRegisterBreak reports a register breakpoint only when the register
+// starts to hold the value, so a register that keeps it does not stop every
+// cycle.
+func (d *Debugger) hitRegisterBreak(cpu *CPU) bool {
+	hit := false
+	for b := range d.regBreaks {
+		matches := cpu.regs[b.register] == b.value
+		if matches && !d.matched[b] {
+			fmt.Fprintf(d.out, "%v is %v\n", b.register, b.value)
+			hit = true
+		}
+		d.matched[b] = matches
+	}
+	return hit
+}
+
+func (d *Debugger) addBreak(args []string, enable bool) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: break|delete CYCLE or REG=VALUE")
+	}
+
+	if reg, value, ok := strings.Cut(args[0], "="); ok {
+		v, err := strconv.Atoi(value)
+		if err != nil || !isRegister(reg) {
+			return fmt.Errorf("%v is not a REG=VALUE breakpoint", args[0])
+		}
+		b := RegisterBreak{register: reg, value: v}
+		if enable {
+			d.regBreaks[b] = true
+		} else {
+			delete(d.regBreaks, b)
+			delete(d.matched, b)
+		}
+		return nil
+	}
+
+	cycle, err := strconv.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("%v is not a cycle", args[0])
+	}
+	if enable {
+		d.cycleBreaks[cycle] = true
+	} else {
+		delete(d.cycleBreaks, cycle)
+	}
+	return nil
+}
+
+// command runs one debugger command and reports whether the program should
+// continue.
+func (d *Debugger) command(l string, cycle int, ins Instruction, cpu *CPU) (bool, error) {
+	fields := strings.Fields(l)
+	if len(fields) == 0 {
+		fields = []string{"step"}
+	}
+
+	args := fields[1:]
+	switch fields[0] {
+	case "s", "step":
+		d.steps = 1
+		if len(args) > 0 {
+			n, err := strconv.Atoi(args[0])
+			if err != nil || n <= 0 {
+				return false, fmt.Errorf("%v is not a number of steps", args[0])
+			}
+			d.steps = n
+		}
+		return true, nil
+	case "c", "continue":
+		d.running = true
+		return true, nil
+	case "b", "break":
+		return false, d.addBreak(args, true)
+	case "d", "delete":
+		return false, d.addBreak(args, false)
+	case "p", "print":
+		d.printState(cycle, ins, cpu)
+		return false, nil
+	case "q", "quit":
+		return false, errQuit
+	default:
+		return false, fmt.Errorf("%v: unknown command", fields[0])
+	}
+}
+
+func (d *Debugger) observe(cycle int, ins Instruction, cpu *CPU) error {
+	pause := d.hitRegisterBreak(cpu) || d.cycleBreaks[cycle]
+	if !d.running {
+		d.steps--
+		pause = pause || d.steps <= 0
+	}
+	if !pause {
+		return nil
+	}
+
+	d.running = false
+	d.printState(cycle, ins, cpu)
+	for {
+		fmt.Fprint(d.out, "(dbg) ")
+		if !d.in.Scan() {
+			fmt.Fprintln(d.out)
+			return errQuit
+		}
+
+		more, err := d.command(d.in.Text(), cycle, ins, cpu)
+		if err != nil {
+			if err == errQuit {
+				return err
+			}
+			fmt.Fprintln(d.out, err)
+		}
+		if more {
+			return nil
+		}
+	}
+}
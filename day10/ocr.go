@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	crtWidth   = 40
+	crtHeight  = 6
+	glyphWidth = 5
+)
+
+type CRT [crtHeight][crtWidth]bool
+
+func (c *CRT) String() string {
+	var b strings.Builder
+	for _, row := range c {
+		for _, lit := range row {
+			if lit {
+				b.WriteByte('#')
+			} else {
+				b.WriteByte('.')
+			}
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// font holds the letters of the 4x6 font, every letter is followed by a blank
+// column.
+var font = map[string]byte{
+	".##.#..##..######..##..#": 'A',
+	"###.#..####.#..##..####.": 'B',
+	".##.#..##...#...#..#.##.": 'C',
+	"#####...###.#...#...####": 'E',
+	"#####...###.#...#...#...": 'F',
+	".##.#..##...#.###..#.###": 'G',
+	"#..##..######..##..##..#": 'H',
+	".###..#...#...#...#..###": 'I',
+	"..##...#...#...##..#.##.": 'J',
+	"#..##.#.##..#.#.#.#.#..#": 'K',
+	"#...#...#...#...#...####": 'L',
+	".##.#..##..##..##..#.##.": 'O',
+	"###.#..##..####.#...#...": 'P',
+	"###.#..##..####.#.#.#..#": 'R',
+	".####...#....##....####.": 'S',
+	"#..##..##..##..##..#.##.": 'U',
+	"####...#..#..#..#...####": 'Z',
+}
+
+func (c *CRT) glyph(index int) string {
+	var b strings.Builder
+	for _, row := range c {
+		for x := index * glyphWidth; x < index*glyphWidth+glyphWidth-1; x++ {
+			if row[x] {
+				b.WriteByte('#')
+			} else {
+				b.WriteByte('.')
+			}
+		}
+	}
+	return b.String()
+}
+
+// decode reads the letters off the screen. Unknown glyphs come out as ? and
+// are listed in the error.
+func decode(c *CRT) (string, error) {
+	var text strings.Builder
+	unknown := make([]string, 0)
+
+	for i := 0; i < crtWidth/glyphWidth; i++ {
+		g := c.glyph(i)
+		if letter, ok := font[g]; ok {
+			text.WriteByte(letter)
+		} else {
+			text.WriteByte('?')
+			unknown = append(unknown, fmt.Sprintf("%v (%v)", i+1, g))
+		}
+	}
+
+	if len(unknown) > 0 {
+		return text.String(), fmt.Errorf("unknown glyphs at %v", strings.Join(unknown, ", "))
+	}
+	return text.String(), nil
+}
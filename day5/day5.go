@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
 	"os"
@@ -14,35 +15,132 @@ type Cmd struct {
 	to    int
 }
 
-func countStacks(l string) int {
-	return len(l) - strings.Count(l, " ")
+type column struct {
+	start int
+	end   int
 }
 
-func parseStacks(lines []string) [][]string {
+func (c column) overlaps(start, end int) bool {
+	return start < c.end && c.start < end
+}
+
+func parseColumns(specLine string) ([]column, error) {
+	result := make([]column, 0)
+	for i := 0; i < len(specLine); {
+		if specLine[i] == ' ' {
+			i++
+			continue
+		}
+
+		start := i
+		for i < len(specLine) && specLine[i] != ' ' {
+			i++
+		}
+
+		label := specLine[start:i]
+		index, err := strconv.Atoi(label)
+		if err != nil {
+			return nil, fmt.Errorf("the stack label %v is not a number", label)
+		}
+		if index != len(result)+1 {
+			return nil, fmt.Errorf("expected stack %v, got %v", len(result)+1, index)
+		}
+
+		result = append(result, column{start: start, end: i})
+	}
+
+	if len(result) == 0 {
+		return nil, fmt.Errorf("the index line %q has no stacks", specLine)
+	}
+
+	return result, nil
+}
+
+func findColumn(columns []column, start, end int) (int, error) {
+	found := -1
+	for i, c := range columns {
+		if c.overlaps(start, end) {
+			if found >= 0 {
+				return 0, fmt.Errorf("the crate at %v spans stacks %v and %v", start, found+1, i+1)
+			}
+			found = i
+		}
+	}
+
+	if found < 0 {
+		return 0, fmt.Errorf("the crate at %v is not above any stack", start)
+	}
+	return found, nil
+}
+
+func parseCrateRow(l string, columns []column) (map[int]string, error) {
+	result := make(map[int]string)
+	for i := 0; i < len(l); i++ {
+		if l[i] == ' ' {
+			continue
+		}
+		if l[i] != '[' {
+			return nil, fmt.Errorf("unexpected character %q at %v", l[i], i)
+		}
+
+		end := strings.IndexByte(l[i:], ']')
+		if end < 0 {
+			return nil, fmt.Errorf("the crate at %v is not closed", i)
+		}
+		end += i
+
+		label := l[i+1 : end]
+		if label == "" || strings.ContainsAny(label, " [") {
+			return nil, fmt.Errorf("the crate at %v has an invalid label %q", i, label)
+		}
+
+		stack, err := findColumn(columns, i, end+1)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := result[stack]; ok {
+			return nil, fmt.Errorf("stack %v has two crates in one row", stack+1)
+		}
+
+		result[stack] = label
+		i = end
+	}
+	return result, nil
+}
+
+func parseStacks(lines []string) ([][]string, error) {
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("the drawing is empty")
+	}
+
 	specLine := lines[len(lines)-1]
 	lines = lines[:len(lines)-1]
 
-	stacks := countStacks(specLine)
+	columns, err := parseColumns(specLine)
+	if err != nil {
+		return nil, fmt.Errorf("line %v: %w", len(lines)+1, err)
+	}
 
-	result := make([][]string, stacks)
+	result := make([][]string, len(columns))
 	for i := range result {
-		result[i] = make([]string, 0, 1)
+		result[i] = make([]string, 0, len(lines))
 	}
 
 	for i := len(lines) - 1; i >= 0; i-- {
-		l := lines[i]
-		for j := 0; j < stacks; j++ {
-			if len(l) >= j*4+3 {
-				spec := strings.TrimSpace(l[(j * 4):(j*4 + 3)])
-				if spec != "" {
-					result[j] = append(result[j], spec[1:2])
-				}
-			}
+		row, err := parseCrateRow(lines[i], columns)
+		if err != nil {
+			return nil, fmt.Errorf("line %v: %w", i+1, err)
 		}
 
+		for j, crate := range row {
+			if len(result[j]) != len(lines)-1-i {
+				return nil, fmt.Errorf("line %v: the crate %v in stack %v is floating", i+1, crate, j+1)
+			}
+			result[j] = append(result[j], crate)
+		}
 	}
 
-	return result
+	return result, nil
 }
 
 func parseCmd(l string) Cmd {
@@ -109,7 +207,75 @@ func part2(stacks [][]string, cmds []Cmd) string {
 	return ret
 }
 
+func readDrawing(path string) ([][]string, error) {
+	rawContent, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	drawing := strings.Split(string(rawContent), "\n\n")[0]
+	return parseStacks(strings.Split(strings.TrimRight(drawing, "\n"), "\n"))
+}
+
+func runPlan(goalPath, model string, maxStates int) {
+	crane, err := craneByModel(model)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	start, err := readDrawing("data.txt")
+	if err != nil {
+		log.Fatal(err)
+	}
+	goal, err := readDrawing(goalPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	cmds, err := plan(start, goal, crane, maxStates)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Print(formatCmds(cmds))
+}
+
+func runHistory(stacks [][]string, cmds []Cmd, model string, after int, crate string, stack int) {
+	crane, err := craneByModel(model)
+	if err != nil {
+		log.Fatal(err)
+	}
+	history := record(stacks, cmds, crane)
+
+	if after >= 0 {
+		state, err := history.after(after)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(renderStacks(state))
+	}
+
+	if crate != "" {
+		k, ok := history.whenReached(crate, stack-1)
+		if !ok {
+			log.Fatalf("the crate %v never reaches stack %v", crate, stack)
+		}
+		fmt.Printf("The crate %v reaches stack %v after command %v\n", crate, stack, k)
+	}
+}
+
 func main() {
+	goalPath := flag.String("plan", "", "print the shortest program that turns data.txt into the drawing in this file")
+	model := flag.String("crane", "9000", "crane model used by -plan, -after and -crate (9000 or 9001)")
+	maxStates := flag.Int("max-states", 1000000, "maximum number of configurations explored by -plan")
+	after := flag.Int("after", -1, "print the drawing after this many commands")
+	crate := flag.String("crate", "", "print after which command this crate first reaches -stack")
+	stack := flag.Int("stack", 1, "stack used by -crate")
+	flag.Parse()
+
+	if *goalPath != "" {
+		runPlan(*goalPath, *model, *maxStates)
+		return
+	}
+
 	rawContent, err := os.ReadFile("data.txt")
 	if err != nil {
 		log.Fatal(err)
@@ -117,11 +283,22 @@ func main() {
 	content := string(rawContent)
 	lines := strings.Split(content, "\n\n")
 
-	stacks := parseStacks(strings.Split(lines[0], "\n"))
+	stacks, err := parseStacks(strings.Split(lines[0], "\n"))
+	if err != nil {
+		log.Fatal(err)
+	}
 	cmds := parseAllCmds(strings.Split(lines[1], "\n"))
 
+	if *after >= 0 || *crate != "" {
+		runHistory(stacks, cmds, *model, *after, *crate, *stack)
+		return
+	}
+
 	fmt.Println("Part 1: ", part1(stacks, cmds))
 
-	stacks = parseStacks(strings.Split(lines[0], "\n"))
+	stacks, err = parseStacks(strings.Split(lines[0], "\n"))
+	if err != nil {
+		log.Fatal(err)
+	}
 	fmt.Println("Part 2: ", part2(stacks, cmds))
 }
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type History struct {
+	cmds   []Cmd
+	states [][][]string
+}
+
+func record(stacks [][]string, cmds []Cmd, crane Crane) History {
+	states := make([][][]string, 0, len(cmds)+1)
+	current := copyStacks(stacks)
+	states = append(states, copyStacks(current))
+
+	for _, c := range cmds {
+		crane(c, current)
+		states = append(states, copyStacks(current))
+	}
+
+	return History{cmds: cmds, states: states}
+}
+
+// after returns the stacks after the first k commands ran, so after(0) is the
+// initial drawing.
+func (h *History) after(k int) ([][]string, error) {
+	if k < 0 || k >= len(h.states) {
+		return nil, fmt.Errorf("the command %v is out of range 0-%v", k, len(h.states)-1)
+	}
+	return h.states[k], nil
+}
+
+// whenReached returns the number of commands after which the crate first
+// appears in the given stack.
+func (h *History) whenReached(crate string, stack int) (int, bool) {
+	if stack < 0 || stack >= len(h.states[0]) {
+		return 0, false
+	}
+
+	for k, s := range h.states {
+		for _, c := range s[stack] {
+			if c == crate {
+				return k, true
+			}
+		}
+	}
+	return 0, false
+}
+
+func renderStacks(stacks [][]string) string {
+	width := len(strconv.Itoa(len(stacks)))
+	height := 0
+	for _, s := range stacks {
+		for _, c := range s {
+			if len(c)+2 > width {
+				width = len(c) + 2
+			}
+		}
+		if len(s) > height {
+			height = len(s)
+		}
+	}
+
+	cell := func(text string) string {
+		left := (width - len(text)) / 2
+		return strings.Repeat(" ", left) + text + strings.Repeat(" ", width-len(text)-left)
+	}
+
+	var b strings.Builder
+	row := make([]string, len(stacks))
+	for level := height - 1; level >= 0; level-- {
+		for i, s := range stacks {
+			if level < len(s) {
+				row[i] = cell("[" + s[level] + "]")
+			} else {
+				row[i] = cell("")
+			}
+		}
+		b.WriteString(strings.TrimRight(strings.Join(row, " "), " "))
+		b.WriteString("\n")
+	}
+
+	for i := range stacks {
+		row[i] = cell(strconv.Itoa(i + 1))
+	}
+	b.WriteString(strings.TrimRight(strings.Join(row, " "), " "))
+
+	return b.String()
+}
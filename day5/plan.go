@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type Crane func(cmd Cmd, stacks [][]string)
+
+func craneByModel(model string) (Crane, error) {
+	switch model {
+	case "9000":
+		return applyV1, nil
+	case "9001":
+		return applyV2, nil
+	default:
+		return nil, fmt.Errorf("the crane model %v is unknown", model)
+	}
+}
+
+func (c Cmd) String() string {
+	return fmt.Sprintf("move %v from %v to %v", c.count, c.from+1, c.to+1)
+}
+
+func formatCmds(cmds []Cmd) string {
+	var b strings.Builder
+	for _, c := range cmds {
+		b.WriteString(c.String())
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func copyStacks(stacks [][]string) [][]string {
+	result := make([][]string, len(stacks))
+	for i, s := range stacks {
+		result[i] = append(make([]string, 0, len(s)), s...)
+	}
+	return result
+}
+
+func stacksKey(stacks [][]string) string {
+	var b strings.Builder
+	for _, s := range stacks {
+		for _, c := range s {
+			b.WriteString(c)
+			b.WriteByte(0)
+		}
+		b.WriteByte(1)
+	}
+	return b.String()
+}
+
+func sortedCrates(stacks [][]string) []string {
+	result := make([]string, 0)
+	for _, s := range stacks {
+		result = append(result, s...)
+	}
+	sort.Strings(result)
+	return result
+}
+
+func checkReachable(start, goal [][]string) error {
+	if len(start) != len(goal) {
+		return fmt.Errorf("the start has %v stacks, but the goal has %v", len(start), len(goal))
+	}
+
+	a := sortedCrates(start)
+	b := sortedCrates(goal)
+	if len(a) != len(b) {
+		return fmt.Errorf("the start has %v crates, but the goal has %v", len(a), len(b))
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return fmt.Errorf("the start and the goal have different crates")
+		}
+	}
+	return nil
+}
+
+type planStep struct {
+	prev string
+	cmd  Cmd
+}
+
+func buildPlan(visited map[string]planStep, startKey, key string) []Cmd {
+	result := make([]Cmd, 0)
+	for key != startKey {
+		step := visited[key]
+		result = append(result, step.cmd)
+		key = step.prev
+	}
+
+	for i, j := 0, len(result)-1; i < j; i, j = i+1, j-1 {
+		result[i], result[j] = result[j], result[i]
+	}
+	return result
+}
+
+// plan finds the shortest list of commands that turns start into goal using
+// a breadth-first search over stack configurations. The search gives up after
+// visiting maxStates configurations.
+func plan(start, goal [][]string, crane Crane, maxStates int) ([]Cmd, error) {
+	if err := checkReachable(start, goal); err != nil {
+		return nil, err
+	}
+
+	startKey := stacksKey(start)
+	goalKey := stacksKey(goal)
+	visited := map[string]planStep{startKey: {}}
+	queue := [][][]string{start}
+
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		currentKey := stacksKey(current)
+
+		if currentKey == goalKey {
+			return buildPlan(visited, startKey, goalKey), nil
+		}
+
+		for from := range current {
+			for to := range current {
+				if from == to {
+					continue
+				}
+
+				for count := 1; count <= len(current[from]); count++ {
+					cmd := Cmd{count: count, from: from, to: to}
+					next := copyStacks(current)
+					crane(cmd, next)
+
+					key := stacksKey(next)
+					if _, ok := visited[key]; ok {
+						continue
+					}
+					if len(visited) >= maxStates {
+						return nil, fmt.Errorf("no plan found within %v states", maxStates)
+					}
+
+					visited[key] = planStep{prev: currentKey, cmd: cmd}
+					queue = append(queue, next)
+				}
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("the goal is unreachable")
+}
@@ -1,42 +1,198 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"os/signal"
+	"strings"
 )
 
-func isSubstringUnique(data string, i, count int) bool {
-	lastChars := make(map[byte]struct{})
+type MarkerDetector struct {
+	window    int
+	tolerance int
+	counts    [256]int
+	ring      []byte
+	distinct  int
+	pos       int
+}
 
-	for j := 0; j < count; j++ {
-		lastChars[data[i-j]] = struct{}{}
+func createMarkerDetector(window, tolerance int) MarkerDetector {
+	return MarkerDetector{
+		window:    window,
+		tolerance: tolerance,
+		ring:      make([]byte, window),
 	}
+}
 
-	return len(lastChars) == count
+// repeats is the number of bytes in the current window that duplicate an
+// earlier byte of the same window.
+func (d *MarkerDetector) repeats() int {
+	return d.window - d.distinct
 }
 
-func part1(data string) int {
-	for i := 3; i < len(data); i++ {
-		if isSubstringUnique(data, i, 4) {
-			return i + 1
+// push adds the next byte of the stream and reports whether the last window
+// bytes contain at most tolerance repeats.
+func (d *MarkerDetector) push(c byte) bool {
+	slot := d.pos % d.window
+	if d.pos >= d.window {
+		old := d.ring[slot]
+		d.counts[old]--
+		if d.counts[old] == 0 {
+			d.distinct--
 		}
 	}
 
-	return -1
+	d.ring[slot] = c
+	d.counts[c]++
+	if d.counts[c] == 1 {
+		d.distinct++
+	}
+	d.pos++
+
+	return d.pos >= d.window && d.repeats() <= d.tolerance
 }
 
-func part2(data string) int {
-	for i := 13; i < len(data); i++ {
-		if isSubstringUnique(data, i, 14) {
-			return i + 1
+func scanBytes(r io.Reader, push func(c byte) bool) error {
+	reader := bufio.NewReader(r)
+	for {
+		c, err := reader.ReadByte()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
 		}
+
+		if !push(c) {
+			return nil
+		}
+	}
+}
+
+func scanMarkers(r io.Reader, window, tolerance int, found func(pos int) bool) error {
+	if window <= 0 {
+		return fmt.Errorf("the window size %v must be positive", window)
+	}
+	if tolerance < 0 {
+		return fmt.Errorf("the tolerance %v must not be negative", tolerance)
+	}
+
+	detector := createMarkerDetector(window, tolerance)
+	return scanBytes(r, func(c byte) bool {
+		return !detector.push(c) || found(detector.pos)
+	})
+}
+
+func findFirstMarker(r io.Reader, window, tolerance int) (int, error) {
+	result := -1
+	err := scanMarkers(r, window, tolerance, func(pos int) bool {
+		result = pos
+		return false
+	})
+	return result, err
+}
+
+// findMostUnique returns the end of the first window with the most distinct
+// bytes together with that number.
+func findMostUnique(r io.Reader, window int) (int, int, error) {
+	if window <= 0 {
+		return -1, 0, fmt.Errorf("the window size %v must be positive", window)
+	}
+
+	bestPos, bestDistinct := -1, 0
+	detector := createMarkerDetector(window, 0)
+	err := scanBytes(r, func(c byte) bool {
+		detector.push(c)
+		if detector.pos >= window && detector.distinct > bestDistinct {
+			bestPos, bestDistinct = detector.pos, detector.distinct
+		}
+		return bestDistinct < window
+	})
+	return bestPos, bestDistinct, err
+}
+
+func part1(data string, tolerance int) (int, error) {
+	return findFirstMarker(strings.NewReader(data), 4, tolerance)
+}
+
+func part2(data string, tolerance int) (int, error) {
+	return findFirstMarker(strings.NewReader(data), 14, tolerance)
+}
+
+func printMarkers(window, tolerance int) {
+	file, err := os.Open("data.txt")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer file.Close()
+
+	err = scanMarkers(file, window, tolerance, func(pos int) bool {
+		fmt.Println(pos)
+		return true
+	})
+	if err != nil {
+		log.Fatal(err)
 	}
+}
+
+func printFrames() {
+	file, err := os.Open("data.txt")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer file.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
 
-	return -1
+	frames, errs := createFrameDecoder().decode(ctx, file)
+	for f := range frames {
+		fmt.Printf("%v at %v: %q\n", f.kind, f.offset, f.data)
+	}
+	if err := <-errs; err != nil {
+		log.Fatal(err)
+	}
+}
+
+func printMostUnique(window int) {
+	file, err := os.Open("data.txt")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer file.Close()
+
+	pos, distinct, err := findMostUnique(file, window)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("The window ending at %v has %v distinct characters\n", pos, distinct)
 }
 
 func main() {
+	frames := flag.Bool("frames", false, "print the frames of the datastream")
+	window := flag.Int("markers", 0, "print every marker position for this window size")
+	tolerance := flag.Int("tolerance", 0, "number of repeated characters allowed in a marker")
+	mostUnique := flag.Int("most-unique", 0, "print the window of this size with the most distinct characters")
+	flag.Parse()
+
+	if *frames {
+		printFrames()
+		return
+	}
+
+	if *mostUnique > 0 {
+		printMostUnique(*mostUnique)
+		return
+	}
+
+	if *window > 0 {
+		printMarkers(*window, *tolerance)
+		return
+	}
 
 	rawContent, err := os.ReadFile("data.txt")
 	if err != nil {
@@ -44,6 +200,15 @@ func main() {
 	}
 	content := string(rawContent)
 
-	fmt.Println("Part 1: ", part1(content))
-	fmt.Println("Part 2: ", part2(content))
+	pos, err := part1(content, *tolerance)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("Part 1: ", pos)
+
+	pos, err = part2(content, *tolerance)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("Part 2: ", pos)
 }
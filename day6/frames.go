@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"io"
+)
+
+type FrameKind int
+
+const (
+	Packet FrameKind = iota
+	Message
+)
+
+func (k FrameKind) String() string {
+	if k == Packet {
+		return "packet"
+	}
+	return "message"
+}
+
+type Frame struct {
+	kind   FrameKind
+	offset int
+	data   []byte
+	more   bool
+}
+
+type FrameDecoder struct {
+	packetWindow  int
+	messageWindow int
+	maxFrame      int
+}
+
+func createFrameDecoder() FrameDecoder {
+	return FrameDecoder{
+		packetWindow:  4,
+		messageWindow: 14,
+		maxFrame:      1 << 20,
+	}
+}
+
+func (fd FrameDecoder) window(k FrameKind) int {
+	if k == Packet {
+		return fd.packetWindow
+	}
+	return fd.messageWindow
+}
+
+// decode splits the stream into frames. Everything before the first
+// start-of-packet marker is skipped, after that start-of-packet and
+// start-of-message markers alternate and every frame holds the bytes between
+// its marker and the next one. Frames longer than maxFrame are delivered in
+// pieces with more set on all but the last one.
+func (fd FrameDecoder) decode(ctx context.Context, r io.Reader) (<-chan Frame, <-chan error) {
+	frames := make(chan Frame)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(frames)
+		defer close(errs)
+
+		send := func(f Frame) bool {
+			select {
+			case frames <- f:
+				return true
+			case <-ctx.Done():
+				errs <- ctx.Err()
+				return false
+			}
+		}
+
+		sendHead := func(f *Frame) bool {
+			head := *f
+			head.data = f.data[:fd.maxFrame]
+			head.more = true
+			f.offset += fd.maxFrame
+			f.data = append([]byte(nil), f.data[fd.maxFrame:]...)
+			return send(head)
+		}
+
+		reader := bufio.NewReader(r)
+		expected := Packet
+		detector := createMarkerDetector(fd.window(expected), 0)
+		var current *Frame
+		pos := 0
+
+		for {
+			if err := ctx.Err(); err != nil {
+				errs <- err
+				return
+			}
+
+			c, err := reader.ReadByte()
+			if err == io.EOF {
+				for current != nil && len(current.data) > fd.maxFrame {
+					if !sendHead(current) {
+						return
+					}
+				}
+				if current != nil {
+					send(*current)
+				}
+				return
+			} else if err != nil {
+				errs <- err
+				return
+			}
+			pos++
+
+			if current != nil {
+				current.data = append(current.data, c)
+			}
+
+			if !detector.push(c) {
+				if current != nil && len(current.data) > fd.maxFrame+detector.window {
+					if !sendHead(current) {
+						return
+					}
+				}
+				continue
+			}
+
+			if current != nil {
+				current.data = current.data[:len(current.data)-detector.window]
+				if !send(*current) {
+					return
+				}
+			}
+
+			current = &Frame{kind: expected, offset: pos}
+			if expected == Packet {
+				expected = Message
+			} else {
+				expected = Packet
+			}
+			detector = createMarkerDetector(fd.window(expected), 0)
+		}
+	}()
+
+	return frames, errs
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
 	"math"
@@ -49,6 +50,8 @@ func createFile(name string, size int, parent *Dir) File {
 type Dir struct {
 	dirname   string
 	nodes     []Node
+	byName    map[string]Node
+	totalSize int
 	parentDir *Dir
 }
 
@@ -57,11 +60,7 @@ func (d *Dir) name() string {
 }
 
 func (d *Dir) size() int {
-	var total int
-	for _, d := range d.nodes {
-		total = total + d.size()
-	}
-	return total
+	return d.totalSize
 }
 
 func (d *Dir) parent() *Dir {
@@ -78,56 +77,113 @@ func (d *Dir) print(indent int) {
 
 func (d *Dir) addNode(n Node) {
 	d.nodes = append(d.nodes, n)
+	d.byName[n.name()] = n
+
+	size := n.size()
+	for p := d; p != nil; p = p.parentDir {
+		p.totalSize += size
+	}
+}
+
+func (d *Dir) child(name string) Node {
+	return d.byName[name]
 }
 
 func createDir(n string, parentDir *Dir) Dir {
 	return Dir{
 		dirname:   n,
 		nodes:     make([]Node, 0),
+		byName:    make(map[string]Node),
 		parentDir: parentDir,
 	}
 }
 
-func parse(lines []string) Dir {
+func parseListing(l string, currentDir *Dir) error {
+	split := strings.Split(l, " ")
+	if len(split) != 2 {
+		return fmt.Errorf("the listing entry %v is malformed", l)
+	}
+
+	existing := currentDir.child(split[1])
+	if split[0] == "dir" {
+		if existing == nil {
+			newDir := createDir(split[1], currentDir)
+			currentDir.addNode(&newDir)
+		} else if _, ok := existing.(*Dir); !ok {
+			return fmt.Errorf("%v is listed as a directory, but it is a file", split[1])
+		}
+		return nil
+	}
+
+	size, err := strconv.Atoi(split[0])
+	if err != nil {
+		return fmt.Errorf("the size %v of %v is not a number", split[0], split[1])
+	}
+
+	if existing == nil {
+		file := createFile(split[1], size, currentDir)
+		currentDir.addNode(&file)
+	} else if f, ok := existing.(*File); !ok {
+		return fmt.Errorf("%v is listed as a file, but it is a directory", split[1])
+	} else if f.size() != size {
+		return fmt.Errorf("%v is listed with size %v, but it was %v before", split[1], size, f.size())
+	}
+	return nil
+}
+
+func changeDir(dir string, topMost, currentDir *Dir) (*Dir, error) {
+	if dir == "/" {
+		return topMost, nil
+	} else if dir == ".." {
+		if currentDir.parent() == nil {
+			return nil, fmt.Errorf("cannot go above /")
+		}
+		return currentDir.parent(), nil
+	}
+
+	child := currentDir.child(dir)
+	if child == nil {
+		return nil, fmt.Errorf("there is no directory %v in %v", dir, currentDir.name())
+	}
+	if d, ok := child.(*Dir); ok {
+		return d, nil
+	}
+	return nil, fmt.Errorf("%v is not a directory", dir)
+}
+
+func parse(lines []string) (*Dir, error) {
 	topMost := createDir("/", nil)
 	var currentDir *Dir = &topMost
 
-	for i := 1; i < len(lines); i++ {
+	for i := 0; i < len(lines); i++ {
 		l := lines[i]
+		if l == "" {
+			continue
+		}
 
-		if !strings.HasPrefix(l, "$") {
-			fmt.Errorf("the line %v is not a proper command", l)
+		if !strings.HasPrefix(l, "$ ") {
+			return nil, fmt.Errorf("line %v: %v is not a proper command", i+1, l)
 		}
 
 		command := l[2:]
-		if strings.HasPrefix(command, "cd") {
-			dir := command[3:]
-			if dir == "/" {
-				currentDir = &topMost
-			} else if dir == ".." {
-				currentDir = currentDir.parent()
-			} else {
-				newDir := createDir(dir, currentDir)
-				currentDir.addNode(&newDir)
-				currentDir = &newDir
+		if strings.HasPrefix(command, "cd ") {
+			dir, err := changeDir(command[3:], &topMost, currentDir)
+			if err != nil {
+				return nil, fmt.Errorf("line %v: %w", i+1, err)
 			}
+			currentDir = dir
 		} else if command == "ls" {
-			i++
-			for i < len(lines) && !strings.HasPrefix(lines[i], "$") {
-				split := strings.Split(lines[i], " ")
-				if split[0] != "dir" {
-					size, _ := strconv.Atoi(split[0])
-					file := createFile(split[1], size, currentDir)
-					currentDir.addNode(&file)
-				}
+			for i+1 < len(lines) && lines[i+1] != "" && !strings.HasPrefix(lines[i+1], "$") {
 				i++
+				if err := parseListing(lines[i], currentDir); err != nil {
+					return nil, fmt.Errorf("line %v: %w", i+1, err)
+				}
 			}
-			i--
 		} else {
-			fmt.Errorf("unknown command %v", command)
+			return nil, fmt.Errorf("line %v: unknown command %v", i+1, command)
 		}
 	}
-	return topMost
+	return &topMost, nil
 }
 
 type Visitor interface {
@@ -141,7 +197,7 @@ func visit(v Visitor, n Node) {
 	} else if f, ok := n.(*File); ok {
 		v.visitFile(f)
 	} else {
-		fmt.Errorf("unknown node %v", n)
+		panic(fmt.Sprintf("unknown node %v", n))
 	}
 }
 
@@ -160,7 +216,7 @@ type SizeLessThan100k struct {
 func (v *SizeLessThan100k) visitFile(f *File) {}
 func (v *SizeLessThan100k) visitDir(d *Dir) {
 	size := d.size()
-	if d.size() <= 100000 {
+	if size <= 100000 {
 		v.totalSize += size
 	}
 	descend(v, d)
@@ -182,25 +238,148 @@ func (v *FindDirToDelete) visitDir(d *Dir) {
 	descend(v, d)
 }
 
-func main() {
-	rawContent, err := os.ReadFile("data.txt")
+func printDeletionPlans(tree *Dir, target int, exclude []string, plans int) {
+	planner := DeletionPlanner{
+		target:  target,
+		exclude: exclude,
+		plans:   plans,
+	}
+	result, err := planner.planDeletions(tree)
 	if err != nil {
 		log.Fatal(err)
 	}
+	if len(result) == 0 {
+		log.Fatalf("no plan frees %v", target)
+	}
+
+	for _, plan := range result {
+		fmt.Printf("total %v, waste %v:\n", plan.total, plan.waste)
+		for _, d := range plan.dirs {
+			fmt.Printf("  %v\t%v\n", d.size(), dirPath(d))
+		}
+	}
+}
+
+func readTranscript(path string) (*Dir, error) {
+	rawContent, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
 	content := string(rawContent)
 	lines := strings.Split(content, "\n")
 
-	tree := parse(lines)
+	return parse(lines)
+}
+
+func readTreeFile(path string) (*Dir, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return readTreeJSON(file)
+}
+
+func printDiff(tree *Dir, newer string, top int, asJSON bool) {
+	newTree, err := readTranscript(newer)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	diff, err := diffTrees(tree, newTree, top)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if asJSON {
+		if err := diff.writeJSON(os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		diff.writeText(os.Stdout)
+	}
+}
+
+func main() {
+	root := flag.String("dir", "", "read the tree from this directory instead of data.txt")
+	printTree := flag.Bool("print", false, "print the tree before solving")
+	interactive := flag.Bool("shell", false, "explore the tree in an interactive shell")
+	planDeletion := flag.Bool("plan-deletion", false, "list the cheapest sets of directories to delete")
+	free := flag.Int("free", -1, "space -plan-deletion has to free, by default what part 2 needs")
+	plans := flag.Int("plans", 5, "number of plans listed by -plan-deletion")
+	exclude := make([]string, 0)
+	flag.Func("exclude", "never delete paths matching this pattern (repeatable)", func(pattern string) error {
+		exclude = append(exclude, pattern)
+		return nil
+	})
+	newer := flag.String("diff", "", "compare the tree with a newer transcript in this file")
+	top := flag.Int("top", 10, "number of growth hotspots listed by -diff")
+	asJSON := flag.Bool("json", false, "print -diff as JSON")
+	fromJSON := flag.String("from-json", "", "read the tree from this JSON file instead of data.txt")
+	toJSON := flag.Bool("to-json", false, "print the tree as JSON")
+	synthesizeTranscript := flag.Bool("synthesize", false, "print the shortest transcript that reconstructs the tree")
+	flag.Parse()
+
+	var tree *Dir
+	var err error
+	if *root != "" {
+		tree, err = loadFS(os.DirFS(*root), ".")
+	} else if *fromJSON != "" {
+		tree, err = readTreeFile(*fromJSON)
+	} else {
+		tree, err = readTranscript("data.txt")
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *toJSON {
+		if err := writeTreeJSON(os.Stdout, tree); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if *synthesizeTranscript {
+		synthesize(os.Stdout, tree)
+		return
+	}
+
+	if *newer != "" {
+		printDiff(tree, *newer, *top, *asJSON)
+		return
+	}
+
+	if *interactive {
+		shell := createShell(tree)
+		if err := shell.run(os.Stdin); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if *planDeletion {
+		target := *free
+		if target < 0 {
+			target = 30000000 - 70000000 + tree.size()
+		}
+		printDeletionPlans(tree, target, exclude, *plans)
+		return
+	}
+
+	if *printTree {
+		tree.print(0)
+	}
 
 	part1 := SizeLessThan100k{totalSize: 0}
-	descend(&part1, &tree)
+	descend(&part1, tree)
 	fmt.Println("Part 1: ", part1.totalSize)
 
 	part2 := FindDirToDelete{
 		targetSize: 30000000 - 70000000 + tree.size(),
 		foundSize:  math.MaxInt,
 	}
-	descend(&part2, &tree)
+	descend(&part2, tree)
 	fmt.Println("Part 2: ", part2.foundSize)
 
 }
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"math"
+	"path"
+	"sort"
+)
+
+type DeletePlan struct {
+	dirs  []*Dir
+	total int
+	waste int
+}
+
+type DeletionPlanner struct {
+	target  int
+	exclude []string
+	plans   int
+}
+
+func (p *DeletionPlanner) excluded(n Node) (bool, error) {
+	for _, pattern := range p.exclude {
+		matched, err := path.Match(pattern, nodePath(n))
+		if err != nil {
+			return false, err
+		}
+		if matched {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+type candidate struct {
+	dir       *Dir
+	protected bool
+	end       int
+}
+
+// collect lists the directories below d in preorder. A directory is protected
+// if it matches an exclusion pattern or contains something that does, because
+// deleting it would delete the excluded path.
+func (p *DeletionPlanner) collect(d *Dir, out []candidate) ([]candidate, bool, error) {
+	protected, err := p.excluded(d)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// Bigger directories go first, so that good plans turn up early and
+	// the small ones left over are cut off by the bounds.
+	nodes := append([]Node{}, d.nodes...)
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return nodes[i].size() > nodes[j].size()
+	})
+
+	for _, n := range nodes {
+		var childProtected bool
+		if child, ok := n.(*Dir); ok {
+			index := len(out)
+			out = append(out, candidate{dir: child})
+			out, childProtected, err = p.collect(child, out)
+			out[index].protected = childProtected
+			out[index].end = len(out)
+		} else {
+			childProtected, err = p.excluded(n)
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		protected = protected || childProtected
+	}
+
+	return out, protected, nil
+}
+
+// upperBound is the total of a plan that frees enough space if there is one:
+// the smallest single directory that is big enough, or else every outermost
+// directory that may be deleted.
+func (p *DeletionPlanner) upperBound(candidates []candidate) (int, bool) {
+	best := -1
+	for _, c := range candidates {
+		size := c.dir.size()
+		if !c.protected && size >= p.target && (best < 0 || size < best) {
+			best = size
+		}
+	}
+	if best >= 0 {
+		return best, true
+	}
+
+	all := 0
+	for i := 0; i < len(candidates); {
+		if candidates[i].protected {
+			i++
+		} else {
+			all += candidates[i].dir.size()
+			i = candidates[i].end
+		}
+	}
+	return all, all >= p.target
+}
+
+type searchState struct {
+	index int
+	total int
+}
+
+type planSearch struct {
+	candidates []candidate
+	target     int
+	plans      int
+	rest       []int
+	limit      int
+	done       bool
+	seen       map[searchState]bool
+	chosen     []*Dir
+	result     []DeletePlan
+}
+
+// keep inserts a plan in order of its total. Plans that free the same total
+// as one already kept are dropped, and once enough plans are kept the limit
+// drops below the worst of them. The search is done when the kept plans free
+// exactly target, target+1 and so on, since nothing can beat them.
+func (s *planSearch) keep(total int) {
+	i := 0
+	for i < len(s.result) && s.result[i].total < total {
+		i++
+	}
+	if i < len(s.result) && s.result[i].total == total {
+		return
+	}
+
+	dirs := append([]*Dir{}, s.chosen...)
+	sort.Slice(dirs, func(i, j int) bool {
+		return dirPath(dirs[i]) < dirPath(dirs[j])
+	})
+	plan := DeletePlan{
+		dirs:  dirs,
+		total: total,
+		waste: total - s.target,
+	}
+	s.result = append(s.result, DeletePlan{})
+	copy(s.result[i+1:], s.result[i:])
+	s.result[i] = plan
+	if len(s.result) > s.plans {
+		s.result = s.result[:s.plans]
+	}
+	if len(s.result) == s.plans {
+		worst := s.result[len(s.result)-1].total
+		s.limit = worst - 1
+		s.done = worst == s.target+s.plans-1
+		s.updateRest()
+	}
+}
+
+// updateRest sets rest[i] to the most that the directories from i onwards
+// can free. Directories above the limit are left out, since no plan kept
+// from now on can delete them.
+func (s *planSearch) updateRest() {
+	for i := len(s.candidates) - 1; i >= 0; i-- {
+		s.rest[i] = s.rest[i+1]
+		c := s.candidates[i]
+		size := c.dir.size()
+		if !c.protected && size <= s.limit && size+s.rest[c.end] > s.rest[i] {
+			s.rest[i] = size + s.rest[c.end]
+		}
+	}
+}
+
+// search either deletes the directory at i, jumping over its subtree, or
+// keeps it and moves on to the next one in preorder. Directories of the same
+// size lead to the same state in many ways, but a state only has to be
+// searched once: the limit never grows, so a second visit cannot keep
+// anything new.
+func (s *planSearch) search(i, total int) {
+	if s.done || total > s.limit {
+		return
+	}
+	if total >= s.target {
+		s.keep(total)
+	}
+	if s.done || i == len(s.candidates) || total+s.rest[i] < s.target {
+		return
+	}
+	state := searchState{index: i, total: total}
+	if s.seen[state] {
+		return
+	}
+	s.seen[state] = true
+
+	c := s.candidates[i]
+	if !c.protected && c.dir.size() > 0 {
+		s.chosen = append(s.chosen, c.dir)
+		s.search(c.end, total+c.dir.size())
+		s.chosen = s.chosen[:len(s.chosen)-1]
+	}
+	s.search(i+1, total)
+}
+
+// planDeletions lists the cheapest sets of non-nested directories below the
+// root whose deletion frees at least target, best plan first. It is a branch
+// and bound over the directories in preorder: a branch stops once its total
+// is worse than the plans kept so far, or once even deleting everything left
+// cannot free enough.
+func (p *DeletionPlanner) planDeletions(root *Dir) ([]DeletePlan, error) {
+	candidates, _, err := p.collect(root, make([]candidate, 0))
+	if err != nil {
+		return nil, err
+	}
+
+	target := p.target
+	if target < 0 {
+		target = 0
+	}
+	bound, ok := p.upperBound(candidates)
+	if (target > 0 && !ok) || p.plans <= 0 {
+		return []DeletePlan{}, nil
+	}
+
+	s := planSearch{
+		candidates: candidates,
+		target:     target,
+		plans:      p.plans,
+		rest:       make([]int, len(candidates)+1),
+		limit:      math.MaxInt,
+		seen:       make(map[searchState]bool),
+		chosen:     make([]*Dir, 0),
+		result:     make([]DeletePlan, 0, p.plans),
+	}
+	// The upper bound only limits the best plan, so it can seed the search
+	// just when a single plan is asked for.
+	if p.plans == 1 {
+		s.limit = bound
+	}
+	s.updateRest()
+	s.search(0, 0)
+
+	return s.result, nil
+}
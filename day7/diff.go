@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+)
+
+type FileChange struct {
+	Path    string `json:"path"`
+	OldSize int    `json:"oldSize"`
+	NewSize int    `json:"newSize"`
+}
+
+// DirChange holds the change of a directory. Delta includes the whole
+// subtree, OwnDelta only the files directly inside the directory.
+type DirChange struct {
+	Path     string `json:"path"`
+	OldSize  int    `json:"oldSize"`
+	NewSize  int    `json:"newSize"`
+	Delta    int    `json:"delta"`
+	OwnDelta int    `json:"ownDelta"`
+}
+
+type TreeDiff struct {
+	Added    []FileChange `json:"added"`
+	Removed  []FileChange `json:"removed"`
+	Changed  []FileChange `json:"changed"`
+	Dirs     []DirChange  `json:"dirs"`
+	Hotspots []DirChange  `json:"hotspots"`
+	grown    []DirChange
+}
+
+// filesSize sums the files directly inside d.
+func filesSize(d *Dir) int {
+	total := 0
+	for _, n := range d.nodes {
+		if _, ok := n.(*Dir); !ok {
+			total += n.size()
+		}
+	}
+	return total
+}
+
+func (td *TreeDiff) addChange(change DirChange) {
+	if change.Delta != 0 {
+		td.Dirs = append(td.Dirs, change)
+	}
+	if change.OwnDelta > 0 {
+		td.grown = append(td.grown, change)
+	}
+}
+
+func (td *TreeDiff) addFiles(n Node, added bool) {
+	if d, ok := n.(*Dir); ok {
+		td.addDir(d, added)
+		return
+	}
+
+	change := FileChange{Path: nodePath(n)}
+	if added {
+		change.NewSize = n.size()
+		td.Added = append(td.Added, change)
+	} else {
+		change.OldSize = n.size()
+		td.Removed = append(td.Removed, change)
+	}
+}
+
+func (td *TreeDiff) addDir(d *Dir, added bool) {
+	change := DirChange{Path: dirPath(d)}
+	if added {
+		change.NewSize = d.size()
+		change.Delta = d.size()
+		change.OwnDelta = filesSize(d)
+	} else {
+		change.OldSize = d.size()
+		change.Delta = -d.size()
+		change.OwnDelta = -filesSize(d)
+	}
+	td.addChange(change)
+
+	for _, n := range d.nodes {
+		td.addFiles(n, added)
+	}
+}
+
+// compare walks two versions of the same directory. Sizes already include the
+// whole subtree, so every change is rolled up to all ancestors.
+func (td *TreeDiff) compare(oldDir, newDir *Dir) {
+	td.addChange(DirChange{
+		Path:     dirPath(newDir),
+		OldSize:  oldDir.size(),
+		NewSize:  newDir.size(),
+		Delta:    newDir.size() - oldDir.size(),
+		OwnDelta: filesSize(newDir) - filesSize(oldDir),
+	})
+
+	for _, o := range oldDir.nodes {
+		n := newDir.child(o.name())
+		oldSub, oldIsDir := o.(*Dir)
+		newSub, newIsDir := n.(*Dir)
+
+		if n == nil || oldIsDir != newIsDir {
+			td.addFiles(o, false)
+		} else if oldIsDir {
+			td.compare(oldSub, newSub)
+		} else if o.size() != n.size() {
+			td.Changed = append(td.Changed, FileChange{Path: nodePath(n), OldSize: o.size(), NewSize: n.size()})
+		}
+	}
+
+	for _, n := range newDir.nodes {
+		o := oldDir.child(n.name())
+		_, oldIsDir := o.(*Dir)
+		_, newIsDir := n.(*Dir)
+
+		if o == nil || oldIsDir != newIsDir {
+			td.addFiles(n, true)
+		}
+	}
+}
+
+// diffTrees lists the changes between two trees. The hotspots are the top
+// directories that grew the most by their own files, so that a parent does
+// not outrank the subdirectory that actually grew.
+func diffTrees(oldTree, newTree *Dir, top int) (TreeDiff, error) {
+	if top < 0 {
+		return TreeDiff{}, fmt.Errorf("the number of hotspots cannot be negative, got %v", top)
+	}
+
+	td := TreeDiff{
+		Added:   make([]FileChange, 0),
+		Removed: make([]FileChange, 0),
+		Changed: make([]FileChange, 0),
+		Dirs:    make([]DirChange, 0),
+		grown:   make([]DirChange, 0),
+	}
+	td.compare(oldTree, newTree)
+
+	sort.Slice(td.Dirs, func(i, j int) bool {
+		return td.Dirs[i].Path < td.Dirs[j].Path
+	})
+
+	hotspots := td.grown
+	sort.Slice(hotspots, func(i, j int) bool {
+		if hotspots[i].OwnDelta != hotspots[j].OwnDelta {
+			return hotspots[i].OwnDelta > hotspots[j].OwnDelta
+		}
+		return hotspots[i].Path < hotspots[j].Path
+	})
+	if len(hotspots) > top {
+		hotspots = hotspots[:top]
+	}
+	td.Hotspots = hotspots
+
+	return td, nil
+}
+
+func (td *TreeDiff) writeText(w io.Writer) {
+	for _, f := range td.Added {
+		fmt.Fprintf(w, "+ %v\t%v\n", f.NewSize, f.Path)
+	}
+	for _, f := range td.Removed {
+		fmt.Fprintf(w, "- %v\t%v\n", f.OldSize, f.Path)
+	}
+	for _, f := range td.Changed {
+		fmt.Fprintf(w, "~ %v -> %v\t%v\n", f.OldSize, f.NewSize, f.Path)
+	}
+
+	fmt.Fprintln(w, "Directories:")
+	for _, d := range td.Dirs {
+		fmt.Fprintf(w, "  %+d\t%v -> %v\t%v\n", d.Delta, d.OldSize, d.NewSize, d.Path)
+	}
+
+	fmt.Fprintln(w, "Hotspots:")
+	for _, d := range td.Hotspots {
+		fmt.Fprintf(w, "  %+d\t%v\n", d.OwnDelta, d.Path)
+	}
+}
+
+func (td *TreeDiff) writeJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(td)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+)
+
+// loadFS builds the tree from the directory root of fsys. Anything that is
+// neither a regular file nor a directory is skipped.
+func loadFS(fsys fs.FS, root string) (*Dir, error) {
+	topMost := createDir("/", nil)
+	dirs := map[string]*Dir{root: &topMost}
+
+	err := fs.WalkDir(fsys, root, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == root {
+			if !entry.IsDir() {
+				return fmt.Errorf("%v is not a directory", root)
+			}
+			return nil
+		}
+
+		parent, ok := dirs[path.Dir(p)]
+		if !ok {
+			return fmt.Errorf("the parent of %v was not visited", p)
+		}
+
+		if entry.IsDir() {
+			newDir := createDir(entry.Name(), parent)
+			parent.addNode(&newDir)
+			dirs[p] = &newDir
+		} else if entry.Type().IsRegular() {
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			file := createFile(entry.Name(), int(info.Size()), parent)
+			parent.addNode(&file)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &topMost, nil
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+type Shell struct {
+	root *Dir
+	cwd  *Dir
+}
+
+func createShell(root *Dir) Shell {
+	return Shell{root: root, cwd: root}
+}
+
+func dirPath(d *Dir) string {
+	if d.parent() == nil {
+		return "/"
+	}
+
+	parts := make([]string, 0)
+	for ; d.parent() != nil; d = d.parent() {
+		parts = append(parts, d.name())
+	}
+
+	var b strings.Builder
+	for i := len(parts) - 1; i >= 0; i-- {
+		b.WriteString("/")
+		b.WriteString(parts[i])
+	}
+	return b.String()
+}
+
+func nodePath(n Node) string {
+	if d, ok := n.(*Dir); ok {
+		return dirPath(d)
+	}
+	parent := dirPath(n.parent())
+	if parent == "/" {
+		return "/" + n.name()
+	}
+	return parent + "/" + n.name()
+}
+
+func (s *Shell) resolve(p string) (Node, error) {
+	var current Node = s.cwd
+	if strings.HasPrefix(p, "/") {
+		current = s.root
+	}
+
+	for _, part := range strings.Split(p, "/") {
+		d, ok := current.(*Dir)
+		if part == "" || part == "." {
+			if !ok {
+				return nil, fmt.Errorf("%v: not a directory", p)
+			}
+			continue
+		}
+		if !ok {
+			return nil, fmt.Errorf("%v: not a directory", p)
+		}
+
+		if part == ".." {
+			if d.parent() != nil {
+				current = d.parent()
+			}
+			continue
+		}
+
+		current = d.child(part)
+		if current == nil {
+			return nil, fmt.Errorf("%v: no such file or directory", p)
+		}
+	}
+	return current, nil
+}
+
+func (s *Shell) resolveDir(p string) (*Dir, error) {
+	n, err := s.resolve(p)
+	if err != nil {
+		return nil, err
+	}
+	d, ok := n.(*Dir)
+	if !ok {
+		return nil, fmt.Errorf("%v: not a directory", p)
+	}
+	return d, nil
+}
+
+func (s *Shell) cd(args []string) error {
+	if len(args) == 0 {
+		s.cwd = s.root
+		return nil
+	}
+	d, err := s.resolveDir(args[0])
+	if err != nil {
+		return err
+	}
+	s.cwd = d
+	return nil
+}
+
+func (s *Shell) ls(args []string) error {
+	target := "."
+	if len(args) > 0 {
+		target = args[0]
+	}
+
+	n, err := s.resolve(target)
+	if err != nil {
+		return err
+	}
+
+	d, ok := n.(*Dir)
+	if !ok {
+		fmt.Println(n.size(), n.name())
+		return nil
+	}
+	for _, n := range d.nodes {
+		if _, ok := n.(*Dir); ok {
+			fmt.Println("dir", n.name())
+		} else {
+			fmt.Println(n.size(), n.name())
+		}
+	}
+	return nil
+}
+
+func (s *Shell) tree(args []string) error {
+	target := "."
+	if len(args) > 0 {
+		target = args[0]
+	}
+
+	n, err := s.resolve(target)
+	if err != nil {
+		return err
+	}
+	n.print(0)
+	return nil
+}
+
+func (s *Shell) du(args []string) error {
+	if len(args) == 0 || args[0] != "-s" {
+		return fmt.Errorf("usage: du -s [path]")
+	}
+
+	target := "."
+	if len(args) > 1 {
+		target = args[1]
+	}
+
+	n, err := s.resolve(target)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%v\t%v\n", n.size(), nodePath(n))
+	return nil
+}
+
+type FindBySize struct {
+	minSize int
+	found   []Node
+}
+
+func (v *FindBySize) visitFile(f *File) {
+	if f.size() > v.minSize {
+		v.found = append(v.found, f)
+	}
+}
+
+func (v *FindBySize) visitDir(d *Dir) {
+	if d.size() > v.minSize {
+		v.found = append(v.found, d)
+	}
+	descend(v, d)
+}
+
+func (s *Shell) find(args []string) error {
+	target := "."
+	if len(args) == 3 {
+		target = args[0]
+		args = args[1:]
+	}
+	if len(args) != 2 || args[0] != "-size" || !strings.HasPrefix(args[1], "+") {
+		return fmt.Errorf("usage: find [path] -size +N")
+	}
+
+	minSize, err := strconv.Atoi(args[1][1:])
+	if err != nil {
+		return fmt.Errorf("find: the size %v is not a number", args[1][1:])
+	}
+
+	n, err := s.resolve(target)
+	if err != nil {
+		return err
+	}
+
+	v := FindBySize{minSize: minSize}
+	visit(&v, n)
+	for _, f := range v.found {
+		fmt.Printf("%v\t%v\n", f.size(), nodePath(f))
+	}
+	return nil
+}
+
+// execute runs a single command line and reports whether the shell should
+// keep running.
+func (s *Shell) execute(l string) (bool, error) {
+	fields := strings.Fields(l)
+	if len(fields) == 0 {
+		return true, nil
+	}
+
+	args := fields[1:]
+	switch fields[0] {
+	case "cd":
+		return true, s.cd(args)
+	case "ls":
+		return true, s.ls(args)
+	case "tree":
+		return true, s.tree(args)
+	case "du":
+		return true, s.du(args)
+	case "find":
+		return true, s.find(args)
+	case "pwd":
+		fmt.Println(dirPath(s.cwd))
+		return true, nil
+	case "exit", "quit":
+		return false, nil
+	default:
+		return true, fmt.Errorf("%v: unknown command", fields[0])
+	}
+}
+
+func (s *Shell) run(in io.Reader) error {
+	scanner := bufio.NewScanner(in)
+	for {
+		fmt.Printf("%v $ ", dirPath(s.cwd))
+		if !scanner.Scan() {
+			fmt.Println()
+			return scanner.Err()
+		}
+
+		more, err := s.execute(scanner.Text())
+		if err != nil {
+			fmt.Println(err)
+		}
+		if !more {
+			return nil
+		}
+	}
+}
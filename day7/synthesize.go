@@ -0,0 +1,245 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+)
+
+type jsonNode struct {
+	Name     string     `json:"name"`
+	Type     string     `json:"type"`
+	Size     int        `json:"size,omitempty"`
+	Children []jsonNode `json:"children,omitempty"`
+}
+
+func toJSONNode(n Node) jsonNode {
+	d, ok := n.(*Dir)
+	if !ok {
+		return jsonNode{Name: n.name(), Type: "file", Size: n.size()}
+	}
+
+	result := jsonNode{Name: d.name(), Type: "dir", Children: make([]jsonNode, 0, len(d.nodes))}
+	for _, child := range d.nodes {
+		result.Children = append(result.Children, toJSONNode(child))
+	}
+	return result
+}
+
+func fromJSONNode(jn jsonNode, parent *Dir) error {
+	if jn.Name == "" || jn.Name == "." || jn.Name == ".." {
+		return fmt.Errorf("the name %q in %v is invalid", jn.Name, dirPath(parent))
+	}
+	if parent.child(jn.Name) != nil {
+		return fmt.Errorf("%v appears twice in %v", jn.Name, dirPath(parent))
+	}
+
+	switch jn.Type {
+	case "file":
+		file := createFile(jn.Name, jn.Size, parent)
+		parent.addNode(&file)
+	case "dir":
+		newDir := createDir(jn.Name, parent)
+		parent.addNode(&newDir)
+		for _, child := range jn.Children {
+			if err := fromJSONNode(child, &newDir); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("%v has an unknown type %q", jn.Name, jn.Type)
+	}
+	return nil
+}
+
+func readTreeJSON(r io.Reader) (*Dir, error) {
+	var jn jsonNode
+	if err := json.NewDecoder(r).Decode(&jn); err != nil {
+		return nil, err
+	}
+	if jn.Type != "dir" {
+		return nil, fmt.Errorf("the root must be a directory")
+	}
+
+	topMost := createDir("/", nil)
+	for _, child := range jn.Children {
+		if err := fromJSONNode(child, &topMost); err != nil {
+			return nil, err
+		}
+	}
+	return &topMost, nil
+}
+
+func writeTreeJSON(w io.Writer, tree *Dir) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(toJSONNode(tree))
+}
+
+// transcriptCost holds, for every depth the walk of a directory may end at,
+// the fewest lines needed to list the whole subtree and which child is
+// visited last to get there.
+type transcriptCost struct {
+	lines []int
+	last  []*Dir
+	// best is the end depth that is cheapest once the walk has to return
+	// to the parent.
+	best int
+}
+
+type TranscriptWriter struct {
+	height int
+	costs  map[*Dir]*transcriptCost
+}
+
+func treeHeight(d *Dir) int {
+	result := 0
+	for _, n := range d.nodes {
+		if child, ok := n.(*Dir); ok {
+			if h := treeHeight(child) + 1; h > result {
+				result = h
+			}
+		}
+	}
+	return result
+}
+
+// returnCost is the number of lines that take the shell from depth from back
+// up to depth to, either with cd .. or with cd / followed by a cd per level.
+func returnCost(from, to int) int {
+	up := from - to
+	if down := 1 + to; down < up {
+		return down
+	}
+	return up
+}
+
+func hasEntries(d *Dir) bool {
+	return len(d.nodes) > 0
+}
+
+func (tw *TranscriptWriter) plan(d *Dir, depth int) *transcriptCost {
+	cost := &transcriptCost{
+		lines: make([]int, tw.height+1),
+		last:  make([]*Dir, tw.height+1),
+	}
+	for i := range cost.lines {
+		cost.lines[i] = math.MaxInt
+	}
+
+	base := 0
+	if hasEntries(d) {
+		base = 1 + len(d.nodes)
+	}
+
+	children := make([]*Dir, 0)
+	for _, n := range d.nodes {
+		if child, ok := n.(*Dir); ok && hasEntries(child) {
+			children = append(children, child)
+		}
+	}
+
+	if len(children) == 0 {
+		cost.lines[depth] = base
+	} else {
+		leave := make(map[*Dir]int)
+		total := base
+		for _, child := range children {
+			c := tw.plan(child, depth+1)
+			leave[child] = 1 + c.lines[c.best] + returnCost(c.best, depth)
+			total += leave[child]
+		}
+
+		for _, child := range children {
+			c := tw.costs[child]
+			for e, lines := range c.lines {
+				if lines == math.MaxInt {
+					continue
+				}
+				candidate := total - leave[child] + 1 + lines
+				if candidate < cost.lines[e] {
+					cost.lines[e] = candidate
+					cost.last[e] = child
+				}
+			}
+		}
+	}
+
+	cost.best = -1
+	for e, lines := range cost.lines {
+		if lines == math.MaxInt {
+			continue
+		}
+		if cost.best < 0 || lines+returnCost(e, depth-1) < cost.lines[cost.best]+returnCost(cost.best, depth-1) {
+			cost.best = e
+		}
+	}
+
+	tw.costs[d] = cost
+	return cost
+}
+
+func (tw *TranscriptWriter) emit(w io.Writer, d *Dir, depth, end int, path []string) {
+	if !hasEntries(d) {
+		return
+	}
+
+	fmt.Fprintln(w, "$ ls")
+	for _, n := range d.nodes {
+		if _, ok := n.(*Dir); ok {
+			fmt.Fprintln(w, "dir", n.name())
+		} else {
+			fmt.Fprintln(w, n.size(), n.name())
+		}
+	}
+
+	last := tw.costs[d].last[end]
+	for _, n := range d.nodes {
+		child, ok := n.(*Dir)
+		if !ok || !hasEntries(child) || child == last {
+			continue
+		}
+
+		c := tw.costs[child]
+		fmt.Fprintln(w, "$ cd", child.name())
+		tw.emit(w, child, depth+1, c.best, append(path, child.name()))
+
+		if c.best-depth <= 1+depth {
+			for i := depth; i < c.best; i++ {
+				fmt.Fprintln(w, "$ cd ..")
+			}
+		} else {
+			fmt.Fprintln(w, "$ cd /")
+			for _, p := range path {
+				fmt.Fprintln(w, "$ cd", p)
+			}
+		}
+	}
+
+	if last != nil {
+		fmt.Fprintln(w, "$ cd", last.name())
+		tw.emit(w, last, depth+1, end, append(path, last.name()))
+	}
+}
+
+// synthesize writes the shortest transcript that parse turns back into tree.
+// Empty directories only need to show up in the listing of their parent, and
+// since parse starts in the root the transcript does not begin with cd /.
+func synthesize(w io.Writer, tree *Dir) int {
+	tw := TranscriptWriter{
+		height: treeHeight(tree),
+		costs:  make(map[*Dir]*transcriptCost),
+	}
+	cost := tw.plan(tree, 0)
+
+	end := 0
+	for e, lines := range cost.lines {
+		if lines < cost.lines[end] {
+			end = e
+		}
+	}
+
+	tw.emit(w, tree, 0, end, make([]string, 0))
+	return cost.lines[end]
+}
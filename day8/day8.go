@@ -1,24 +1,77 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
 	"os"
+	"strconv"
 	"strings"
 )
 
-func parse(lines []string) [][]int {
+func splitCommas(l string) []string {
+	cells := strings.Split(l, ",")
+	for i := range cells {
+		cells[i] = strings.TrimSpace(cells[i])
+	}
+	return cells
+}
+
+func splitDigits(l string) []string {
+	return strings.Split(l, "")
+}
+
+// gridSplitter picks the cell separator once for the whole grid: commas if
+// any line has one, else whitespace if any line has some, else single digits.
+func gridSplitter(lines []string) func(l string) []string {
+	anyWhitespace := false
+	for _, l := range lines {
+		if strings.Contains(l, ",") {
+			return splitCommas
+		}
+		anyWhitespace = anyWhitespace || strings.ContainsAny(l, " \t")
+	}
+	if anyWhitespace {
+		return strings.Fields
+	}
+	return splitDigits
+}
+
+// parse reads a grid of digits, or of integers separated by commas or
+// whitespace. Every row has to use the same format. Trailing empty lines are
+// ignored.
+func parse(lines []string) ([][]int, error) {
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("the grid is empty")
+	}
+
+	splitCells := gridSplitter(lines)
 	result := make([][]int, len(lines))
 	for i, l := range lines {
-		single := make([]int, len(l))
+		cells := splitCells(strings.TrimRight(l, "\r"))
+		if i > 0 && len(cells) != len(result[0]) {
+			return nil, fmt.Errorf("line %v: expected %v trees, got %v", i+1, len(result[0]), len(cells))
+		}
 
-		for j, c := range l {
-			single[j] = int(c - '0')
+		single := make([]int, len(cells))
+		for j, c := range cells {
+			h, err := strconv.Atoi(c)
+			if err != nil {
+				return nil, fmt.Errorf("line %v, column %v: %q is not a height", i+1, j+1, c)
+			}
+			single[j] = h
 		}
 
 		result[i] = single
 	}
-	return result
+
+	if len(result[0]) == 0 {
+		return nil, fmt.Errorf("line 1: there are no trees")
+	}
+	return result, nil
 }
 
 func isVisible(plantMap [][]int, x, y, oX, oY int) bool {
@@ -59,36 +112,200 @@ func scenicScore(plantMap [][]int, x, y int) int {
 	return howManyCanItSee(plantMap, x, y, -1, 0) * howManyCanItSee(plantMap, x, y, 1, 0) * howManyCanItSee(plantMap, x, y, 0, -1) * howManyCanItSee(plantMap, x, y, 0, 1)
 }
 
-func part1(plantMap [][]int) int {
-	total := len(plantMap)*2 + len(plantMap[0])*2 - 4
+type Direction struct {
+	oX int
+	oY int
+}
 
-	for y := 1; y < len(plantMap)-1; y++ {
-		for x := 1; x < len(plantMap[0])-1; x++ {
-			if isVisible(plantMap, x, y, -1, 0) || isVisible(plantMap, x, y, 1, 0) || isVisible(plantMap, x, y, 0, -1) || isVisible(plantMap, x, y, 0, 1) {
-				total++
+var axisDirections = []Direction{{-1, 0}, {1, 0}, {0, -1}, {0, 1}}
+var allDirections = []Direction{{-1, 0}, {1, 0}, {0, -1}, {0, 1}, {-1, -1}, {1, -1}, {-1, 1}, {1, 1}}
+
+type SightRules struct {
+	directions []Direction
+	// maxDistance limits how far a tree can see, 0 means no limit. The
+	// viewing distance is capped at it, and a tree is only visible from the
+	// edge if nothing blocks it and the edge is at most maxDistance away.
+	maxDistance int
+	// strict makes only strictly taller trees block the view.
+	strict bool
+}
+
+func defaultRules() SightRules {
+	return SightRules{directions: axisDirections}
+}
+
+func (r SightRules) blocks(other, height int) bool {
+	if r.strict {
+		return other > height
+	}
+	return other >= height
+}
+
+type Analysis struct {
+	visible  [][]bool
+	distance [][][]int
+	scenic   [][]int
+}
+
+// sweepLine walks a chain of trees against the viewing direction, so every
+// tree's blocker has been seen already. The stack only keeps trees that are
+// not hidden behind a later one.
+func sweepLine(heights []int, rules SightRules, found func(i, distance int, visible bool)) {
+	stack := make([]int, 0, len(heights))
+	for i, h := range heights {
+		for len(stack) > 0 && !rules.blocks(heights[stack[len(stack)-1]], h) {
+			stack = stack[:len(stack)-1]
+		}
+
+		distance, visible := i, true
+		if len(stack) > 0 {
+			distance, visible = i-stack[len(stack)-1], false
+		}
+		if rules.maxDistance > 0 && distance > rules.maxDistance {
+			distance, visible = rules.maxDistance, false
+		}
+
+		found(i, distance, visible)
+		stack = append(stack, i)
+	}
+}
+
+func inside(plantMap [][]int, x, y int) bool {
+	return x >= 0 && y >= 0 && y < len(plantMap) && x < len(plantMap[y])
+}
+
+func analyze(plantMap [][]int, rules SightRules) Analysis {
+	height, width := len(plantMap), len(plantMap[0])
+	result := Analysis{
+		visible:  make([][]bool, height),
+		distance: make([][][]int, len(rules.directions)),
+		scenic:   make([][]int, height),
+	}
+	for y := range plantMap {
+		result.visible[y] = make([]bool, width)
+		result.scenic[y] = make([]int, width)
+		for x := range result.scenic[y] {
+			result.scenic[y][x] = 1
+		}
+	}
+
+	xs, ys, heights := make([]int, 0), make([]int, 0), make([]int, 0)
+	for d, dir := range rules.directions {
+		distance := make([][]int, height)
+		for y := range distance {
+			distance[y] = make([]int, width)
+		}
+		result.distance[d] = distance
+
+		for y := range plantMap {
+			for x := range plantMap[y] {
+				if inside(plantMap, x+dir.oX, y+dir.oY) {
+					continue
+				}
+
+				xs, ys, heights = xs[:0], ys[:0], heights[:0]
+				for cx, cy := x, y; inside(plantMap, cx, cy); cx, cy = cx-dir.oX, cy-dir.oY {
+					xs = append(xs, cx)
+					ys = append(ys, cy)
+					heights = append(heights, plantMap[cy][cx])
+				}
+
+				sweepLine(heights, rules, func(i, dist int, visible bool) {
+					distance[ys[i]][xs[i]] = dist
+					result.visible[ys[i]][xs[i]] = result.visible[ys[i]][xs[i]] || visible
+					result.scenic[ys[i]][xs[i]] *= dist
+				})
 			}
 		}
 	}
 
-	return total
+	return result
+}
+
+func parseDirections(spec string) ([]Direction, error) {
+	if spec == "4" {
+		return axisDirections, nil
+	} else if spec == "8" {
+		return allDirections, nil
+	}
+
+	result := make([]Direction, 0)
+	for _, v := range strings.Split(spec, ";") {
+		var dir Direction
+		if _, err := fmt.Sscanf(v, "%d,%d", &dir.oX, &dir.oY); err != nil {
+			return nil, fmt.Errorf("the direction %q is not a dx,dy vector", v)
+		}
+		if dir.oX == 0 && dir.oY == 0 {
+			return nil, fmt.Errorf("the direction %q does not move", v)
+		}
+		result = append(result, dir)
+	}
+	return result, nil
 }
 
-func part2(plantMap [][]int) int {
+func part1(analysis Analysis) int {
 	total := 0
+	for _, row := range analysis.visible {
+		for _, visible := range row {
+			if visible {
+				total++
+			}
+		}
+	}
+	return total
+}
 
-	for y := 1; y < len(plantMap)-1; y++ {
-		for x := 1; x < len(plantMap[0])-1; x++ {
-			score := scenicScore(plantMap, x, y)
+func part2(analysis Analysis) int {
+	total := 0
+	for _, row := range analysis.scenic {
+		for _, score := range row {
 			if score > total {
 				total = score
 			}
 		}
 	}
-
 	return total
 }
 
+func printPlacements(plantMap [][]int, h, replaceMax int) {
+	canReplace := func(x, y int) bool {
+		return replaceMax < 0 || plantMap[y][x] <= replaceMax
+	}
+
+	scenic, found := bestScenicPlacement(plantMap, h, canReplace)
+	if !found {
+		log.Fatalf("there is no tree of height %v or less to replace", replaceMax)
+	}
+	fmt.Printf("Best scenic score %v at %v,%v\n", scenic.score, scenic.x, scenic.y)
+
+	blocking, _ := leastBlockingPlacement(plantMap, h, canReplace)
+	fmt.Printf("Fewest blocked trees %v at %v,%v\n", blocking.blocked, blocking.x, blocking.y)
+}
+
 func main() {
+	dirs := flag.String("directions", "4", "directions to look in: 4, 8 or dx,dy vectors separated by ;")
+	maxDistance := flag.Int("range", 0, "maximum view distance, 0 for unlimited")
+	strict := flag.Bool("strict", false, "only strictly taller trees block the view")
+	heightsImage := flag.String("heights", "", "write the heights with visible trees highlighted to this .png or .ppm file")
+	scenicImage := flag.String("scenic", "", "write the scenic scores with the best spot marked to this .png or .ppm file")
+	scale := flag.Int("scale", 4, "pixels per tree in images")
+	plant := flag.Int("plant", -1, "find the best cells for a new tree of this height")
+	replaceMax := flag.Int("replace-max", -1, "only replace trees up to this height with -plant, -1 for any")
+	flag.Parse()
+
+	if *scale <= 0 {
+		log.Fatalf("the scale %v must be positive", *scale)
+	}
+
+	rules := defaultRules()
+	rules.maxDistance = *maxDistance
+	rules.strict = *strict
+	var err error
+	rules.directions, err = parseDirections(*dirs)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	rawContent, err := os.ReadFile("data.txt")
 	if err != nil {
 		log.Fatal(err)
@@ -96,9 +313,28 @@ func main() {
 	content := string(rawContent)
 	lines := strings.Split(content, "\n")
 
-	plantMap := parse(lines)
+	plantMap, err := parse(lines)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	analysis := analyze(plantMap, rules)
+	if *heightsImage != "" {
+		if err := writeImage(*heightsImage, renderHeights(plantMap, analysis, *scale)); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *scenicImage != "" {
+		if err := writeImage(*scenicImage, renderScenic(analysis, *scale)); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *plant >= 0 {
+		printPlacements(plantMap, *plant, *replaceMax)
+	}
 
-	fmt.Println("Part 1: ", part1(plantMap))
-	fmt.Println("Part 2: ", part2(plantMap))
+	fmt.Println("Part 1: ", part1(analysis))
+	fmt.Println("Part 2: ", part2(analysis))
 
 }
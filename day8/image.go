@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+var bestMarker = color.RGBA{R: 255, A: 255}
+
+func heightRange(plantMap [][]int) (int, int) {
+	lowest, highest := plantMap[0][0], plantMap[0][0]
+	for _, row := range plantMap {
+		for _, h := range row {
+			if h < lowest {
+				lowest = h
+			}
+			if h > highest {
+				highest = h
+			}
+		}
+	}
+	return lowest, highest
+}
+
+// heightColor draws the height as grayscale and tints visible trees green.
+func heightColor(h, lowest, highest int, visible bool) color.RGBA {
+	level := uint8(255)
+	if highest > lowest {
+		level = uint8(float64(h-lowest) * 255 / float64(highest-lowest))
+	}
+	if visible {
+		return color.RGBA{R: level / 2, G: 128 + level/2, B: level / 2, A: 255}
+	}
+	return color.RGBA{R: level, G: level, B: level, A: 255}
+}
+
+// rampColor maps 0..1 onto a blue, cyan, green, yellow, red ramp.
+func rampColor(t float64) color.RGBA {
+	stops := []color.RGBA{
+		{0, 0, 128, 255},
+		{0, 192, 255, 255},
+		{0, 200, 0, 255},
+		{255, 255, 0, 255},
+		{255, 64, 0, 255},
+	}
+
+	t = math.Max(0, math.Min(1, t)) * float64(len(stops)-1)
+	i := int(t)
+	if i == len(stops)-1 {
+		return stops[i]
+	}
+	f := t - float64(i)
+	mix := func(a, b uint8) uint8 {
+		return uint8(float64(a) + (float64(b)-float64(a))*f)
+	}
+	return color.RGBA{mix(stops[i].R, stops[i+1].R), mix(stops[i].G, stops[i+1].G), mix(stops[i].B, stops[i+1].B), 255}
+}
+
+func bestSpot(scenic [][]int) (int, int) {
+	bestX, bestY := 0, 0
+	for y, row := range scenic {
+		for x, score := range row {
+			if score > scenic[bestY][bestX] {
+				bestX, bestY = x, y
+			}
+		}
+	}
+	return bestX, bestY
+}
+
+func fillCell(img *image.RGBA, x, y, scale int, c color.RGBA) {
+	for py := y * scale; py < (y+1)*scale; py++ {
+		for px := x * scale; px < (x+1)*scale; px++ {
+			img.SetRGBA(px, py, c)
+		}
+	}
+}
+
+// markCell draws a cross over the cell, stretched a bit so that it stays
+// visible at a scale of one pixel per tree.
+func markCell(img *image.RGBA, x, y, scale int) {
+	cx, cy := x*scale+scale/2, y*scale+scale/2
+	arm := scale + 2
+	for i := -arm; i <= arm; i++ {
+		img.SetRGBA(cx+i, cy, bestMarker)
+		img.SetRGBA(cx, cy+i, bestMarker)
+	}
+}
+
+func renderHeights(plantMap [][]int, analysis Analysis, scale int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, len(plantMap[0])*scale, len(plantMap)*scale))
+	lowest, highest := heightRange(plantMap)
+	for y, row := range plantMap {
+		for x, h := range row {
+			fillCell(img, x, y, scale, heightColor(h, lowest, highest, analysis.visible[y][x]))
+		}
+	}
+	return img
+}
+
+// renderScenic colors the scores on a logarithmic scale, since a few spots
+// score orders of magnitude higher than the rest.
+func renderScenic(analysis Analysis, scale int) *image.RGBA {
+	scenic := analysis.scenic
+	img := image.NewRGBA(image.Rect(0, 0, len(scenic[0])*scale, len(scenic)*scale))
+
+	bestX, bestY := bestSpot(scenic)
+	top := math.Log1p(float64(scenic[bestY][bestX]))
+	for y, row := range scenic {
+		for x, score := range row {
+			t := 0.0
+			if top > 0 {
+				t = math.Log1p(float64(score)) / top
+			}
+			fillCell(img, x, y, scale, rampColor(t))
+		}
+	}
+
+	markCell(img, bestX, bestY, scale)
+	return img
+}
+
+func writePPM(w io.Writer, img *image.RGBA) error {
+	bw := bufio.NewWriter(w)
+	bounds := img.Bounds()
+	fmt.Fprintf(bw, "P6\n%v %v\n255\n", bounds.Dx(), bounds.Dy())
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := img.RGBAAt(x, y)
+			bw.Write([]byte{c.R, c.G, c.B})
+		}
+	}
+	return bw.Flush()
+}
+
+// writeImage picks PNG or PPM from the file extension.
+func writeImage(path string, img *image.RGBA) error {
+	ext := filepath.Ext(path)
+	if ext != ".png" && ext != ".ppm" {
+		return fmt.Errorf("the image format of %v is unknown, use .png or .ppm", path)
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if ext == ".png" {
+		err = png.Encode(file, img)
+	} else {
+		err = writePPM(file, img)
+	}
+
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,144 @@
+package main
+
+type Placement struct {
+	x       int
+	y       int
+	score   int
+	blocked int
+}
+
+// withTree runs f while the cell holds a tree of height h instead of its own.
+func withTree(plantMap [][]int, x, y, h int, f func()) {
+	old := plantMap[y][x]
+	plantMap[y][x] = h
+	f()
+	plantMap[y][x] = old
+}
+
+// bestScenicPlacement finds the cell where a tree of height h gets the highest
+// scenic score. Only cells accepted by canReplace are considered.
+func bestScenicPlacement(plantMap [][]int, h int, canReplace func(x, y int) bool) (Placement, bool) {
+	best, found := Placement{}, false
+	for y := range plantMap {
+		for x := range plantMap[y] {
+			if !canReplace(x, y) {
+				continue
+			}
+
+			var score int
+			withTree(plantMap, x, y, h, func() {
+				score = scenicScore(plantMap, x, y)
+			})
+			if !found || score > best.score {
+				best, found = Placement{x: x, y: y, score: score}, true
+			}
+		}
+	}
+	return best, found
+}
+
+// visibility holds, for every direction, whether each tree can be seen from
+// outside the forest in that direction.
+func visibility(plantMap [][]int) [][][]bool {
+	result := make([][][]bool, len(axisDirections))
+	for d, dir := range axisDirections {
+		result[d] = make([][]bool, len(plantMap))
+		for y := range plantMap {
+			result[d][y] = make([]bool, len(plantMap[y]))
+			for x := range plantMap[y] {
+				result[d][y][x] = isVisible(plantMap, x, y, dir.oX, dir.oY)
+			}
+		}
+	}
+	return result
+}
+
+func visibleAnywhere(vis [][][]bool, x, y int) bool {
+	for d := range vis {
+		if vis[d][y][x] {
+			return true
+		}
+	}
+	return false
+}
+
+// blockedOnLine counts the trees on one line through the new tree at p that
+// were visible and are not anymore. heights holds the line, towards[i] is the
+// direction index pointing from tree i towards p and cell maps a line index
+// back to the grid.
+func blockedOnLine(heights []int, p, h int, vis [][][]bool, cell func(i int) (int, int), towards func(i int) int) int {
+	beyond := func(from, step int) int {
+		result := -1
+		for i := from; i >= 0 && i < len(heights); i += step {
+			if heights[i] > result {
+				result = heights[i]
+			}
+		}
+		return result
+	}
+
+	blocked := 0
+	for _, step := range []int{-1, 1} {
+		behind := beyond(p-step, -step)
+		between := -1
+		for i := p + step; i >= 0 && i < len(heights); i += step {
+			x, y := cell(i)
+			if visibleAnywhere(vis, x, y) {
+				after := between < heights[i] && behind < heights[i] && h < heights[i]
+				for d := range vis {
+					if d != towards(step) && vis[d][y][x] {
+						after = true
+					}
+				}
+				if !after {
+					blocked++
+				}
+			}
+			if heights[i] > between {
+				between = heights[i]
+			}
+		}
+	}
+	return blocked
+}
+
+// leastBlockingPlacement finds the cell where a tree of height h hides the
+// fewest currently visible trees. Replacing a tree can also uncover others,
+// those are not counted.
+func leastBlockingPlacement(plantMap [][]int, h int, canReplace func(x, y int) bool) (Placement, bool) {
+	vis := visibility(plantMap)
+
+	best, found := Placement{}, false
+	for y := range plantMap {
+		for x := range plantMap[y] {
+			if !canReplace(x, y) {
+				continue
+			}
+
+			row := plantMap[y]
+			column := make([]int, len(plantMap))
+			for i := range plantMap {
+				column[i] = plantMap[i][x]
+			}
+
+			// Trees left of x look right (index 1) towards it and so on.
+			blocked := blockedOnLine(row, x, h, vis, func(i int) (int, int) { return i, y }, func(step int) int {
+				if step < 0 {
+					return 1
+				}
+				return 0
+			})
+			blocked += blockedOnLine(column, y, h, vis, func(i int) (int, int) { return x, i }, func(step int) int {
+				if step < 0 {
+					return 3
+				}
+				return 2
+			})
+
+			if !found || blocked < best.blocked {
+				best, found = Placement{x: x, y: y, blocked: blocked}, true
+			}
+		}
+	}
+	return best, found
+}
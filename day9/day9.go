@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
 	"os"
@@ -15,8 +16,27 @@ const (
 	Up
 	Right
 	Down
+	UpLeft
+	UpRight
+	DownLeft
+	DownRight
+	Forward
+	Backward
 )
 
+var directionNames = map[string]Direction{
+	"L":  Left,
+	"U":  Up,
+	"R":  Right,
+	"D":  Down,
+	"UL": UpLeft,
+	"UR": UpRight,
+	"DL": DownLeft,
+	"DR": DownRight,
+	"F":  Forward,
+	"B":  Backward,
+}
+
 type Move struct {
 	dir    Direction
 	length int
@@ -25,6 +45,7 @@ type Move struct {
 type Pos struct {
 	x int
 	y int
+	z int
 }
 
 func abs(x int) int {
@@ -45,106 +66,245 @@ func clamp(x, a, b int) int {
 	}
 }
 
-func parse(l string) Move {
-	split := strings.Split(l, " ")
-	length, _ := strconv.Atoi(split[1])
-	if split[0] == "R" {
-		return Move{dir: Right, length: length}
-	} else if split[0] == "U" {
-		return Move{dir: Up, length: length}
-	} else if split[0] == "D" {
-		return Move{dir: Down, length: length}
-	} else {
-		return Move{dir: Left, length: length}
+type moveParser struct {
+	line string
+	pos  int
+}
+
+func (p *moveParser) skipSpaces() {
+	for p.pos < len(p.line) && p.line[p.pos] == ' ' {
+		p.pos++
 	}
 }
 
-func toOffset(m Move) (int, int) {
-	if m.dir == Left {
-		return -m.length, 0
-	} else if m.dir == Up {
-		return 0, m.length
-	} else if m.dir == Right {
-		return m.length, 0
-	} else {
-		return 0, -m.length
+func (p *moveParser) word(valid func(c byte) bool) string {
+	start := p.pos
+	for p.pos < len(p.line) && valid(p.line[p.pos]) {
+		p.pos++
 	}
+	return p.line[start:p.pos]
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isLetter(c byte) bool {
+	return c >= 'A' && c <= 'Z'
 }
 
-func areAdjacent(h, t Pos) bool {
-	return abs(h.x-t.x) <= 1 && abs(h.y-t.y) <= 1
+// sequence parses moves separated by commas until the end of the line or a
+// closing parenthesis.
+func (p *moveParser) sequence(output []Move) ([]Move, error) {
+	for {
+		var err error
+		output, err = p.item(output)
+		if err != nil {
+			return nil, err
+		}
+
+		p.skipSpaces()
+		if p.pos < len(p.line) && p.line[p.pos] == ',' {
+			p.pos++
+			continue
+		}
+		return output, nil
+	}
+}
+
+// maxMoves limits how many moves repeated groups may expand to.
+const maxMoves = 1000000
+
+// item parses a single move like "UR 3" or a repeated group like "4*(R 1, U 1)".
+func (p *moveParser) item(output []Move) ([]Move, error) {
+	p.skipSpaces()
+	start := p.pos
+	if count := p.word(isDigit); count != "" {
+		times, err := strconv.Atoi(count)
+		if err != nil {
+			return nil, fmt.Errorf("column %v: the repeat count %v is too large", start+1, count)
+		}
+		if !strings.HasPrefix(p.line[p.pos:], "*(") {
+			return nil, fmt.Errorf("column %v: expected *( after the repeat count", p.pos+1)
+		}
+		p.pos += 2
+
+		group, err := p.sequence(make([]Move, 0))
+		if err != nil {
+			return nil, err
+		}
+		if p.pos >= len(p.line) || p.line[p.pos] != ')' {
+			return nil, fmt.Errorf("column %v: expected )", p.pos+1)
+		}
+		p.pos++
+
+		if len(group) > 0 && times > (maxMoves-len(output))/len(group) {
+			return nil, fmt.Errorf("column %v: the repeat expands to more than %v moves", start+1, maxMoves)
+		}
+		for i := 0; i < times; i++ {
+			output = append(output, group...)
+		}
+		return output, nil
+	}
+
+	name := p.word(isLetter)
+	dir, ok := directionNames[name]
+	if !ok {
+		return nil, fmt.Errorf("column %v: unknown direction %q", start+1, name)
+	}
+
+	p.skipSpaces()
+	start = p.pos
+	length, err := strconv.Atoi(p.word(isDigit))
+	if err != nil {
+		return nil, fmt.Errorf("column %v: expected the length of the move", start+1)
+	}
+
+	return append(output, Move{dir: dir, length: length}), nil
+}
+
+func parse(l string, output []Move) ([]Move, error) {
+	p := moveParser{line: l}
+	output, err := p.sequence(output)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.line) {
+		return nil, fmt.Errorf("column %v: unexpected %q", p.pos+1, p.line[p.pos:])
+	}
+	return output, nil
+}
+
+func toOffset(m Move) (int, int, int) {
+	switch m.dir {
+	case Left:
+		return -m.length, 0, 0
+	case Up:
+		return 0, m.length, 0
+	case Right:
+		return m.length, 0, 0
+	case Down:
+		return 0, -m.length, 0
+	case UpLeft:
+		return -m.length, m.length, 0
+	case UpRight:
+		return m.length, m.length, 0
+	case DownLeft:
+		return -m.length, -m.length, 0
+	case DownRight:
+		return m.length, -m.length, 0
+	case Forward:
+		return 0, 0, m.length
+	default:
+		return 0, 0, -m.length
+	}
+}
+
+// areAdjacent reports whether t is close enough to h to stay in place, that
+// is at most slack king moves away.
+func areAdjacent(h, t Pos, slack int) bool {
+	return chebyshev(h, t) <= slack
 }
 
 func isCovering(h, t Pos) bool {
-	return h.x == t.x && h.y == t.y
+	return h == t
 }
 
-func getMove(h, t Pos) (int, int) {
+func getMove(h, t Pos) (int, int, int) {
 	ox := clamp(h.x-t.x, -1, 1)
 	oy := clamp(h.y-t.y, -1, 1)
+	oz := clamp(h.z-t.z, -1, 1)
 
-	return ox, oy
+	return ox, oy, oz
 }
 
-func add(p Pos, x, y int) Pos {
+func add(p Pos, x, y, z int) Pos {
 	return Pos{
 		x: p.x + x,
 		y: p.y + y,
+		z: p.z + z,
 	}
 }
 
-func part1(moves []Move) int {
-	visited := make(map[Pos]struct{})
-
-	head := Pos{x: 0, y: 0}
-	tail := Pos{x: 0, y: 0}
-	visited[tail] = struct{}{}
-
-	for _, m := range moves {
-		ox, oy := toOffset(m)
-		head = add(head, ox, oy)
+type RopeStats struct {
+	visited   []map[Pos]struct{}
+	maxSpread int
+}
 
-		for !areAdjacent(head, tail) {
-			ox, oy = getMove(head, tail)
-			tail = add(tail, ox, oy)
-			visited[tail] = struct{}{}
-		}
+// chebyshev is the number of king moves between a and b, so knots at
+// distance one touch in any of the 26 neighbouring cells.
+func chebyshev(a, b Pos) int {
+	result := abs(a.x - b.x)
+	if dy := abs(a.y - b.y); dy > result {
+		result = dy
 	}
-
-	return len(visited)
+	if dz := abs(a.z - b.z); dz > result {
+		result = dz
+	}
+	return result
 }
 
-func part2(moves []Move) int {
-	visited := make(map[Pos]struct{})
+type RopeObserver interface {
+	stepped(rope []Pos)
+	moved(m Move, rope []Pos)
+}
 
-	snake := make([]Pos, 10)
-	for i, _ := range snake {
-		snake[i] = Pos{x: 0, y: 0}
+// simulate moves the head one step at a time and lets every following knot
+// catch up once it is more than slack steps away from the one before it. The
+// observer, if any, sees the rope after every step and every move.
+func simulate(moves []Move, knots, slack int, observer RopeObserver) RopeStats {
+	rope := make([]Pos, knots)
+	stats := RopeStats{visited: make([]map[Pos]struct{}, knots)}
+	for i := range stats.visited {
+		stats.visited[i] = map[Pos]struct{}{rope[i]: {}}
 	}
-	visited[snake[len(snake)-1]] = struct{}{}
 
 	for _, m := range moves {
-		dx, dy := toOffset(m)
-		newHead := add(snake[0], dx, dy)
-		for !isCovering(snake[0], newHead) {
-			hx, hy := getMove(newHead, snake[0])
-			snake[0] = add(snake[0], hx, hy)
-
-			for i := 1; i < len(snake); i++ {
-				if !areAdjacent(snake[i-1], snake[i]) {
-					ox, oy := getMove(snake[i-1], snake[i])
-					snake[i] = add(snake[i], ox, oy)
+		dx, dy, dz := toOffset(m)
+		newHead := add(rope[0], dx, dy, dz)
+		for !isCovering(rope[0], newHead) {
+			hx, hy, hz := getMove(newHead, rope[0])
+			rope[0] = add(rope[0], hx, hy, hz)
+			stats.visited[0][rope[0]] = struct{}{}
+
+			for i := 1; i < len(rope); i++ {
+				if !areAdjacent(rope[i-1], rope[i], slack) {
+					ox, oy, oz := getMove(rope[i-1], rope[i])
+					rope[i] = add(rope[i], ox, oy, oz)
+					stats.visited[i][rope[i]] = struct{}{}
 				}
 			}
 
-			visited[snake[len(snake)-1]] = struct{}{}
+			if spread := chebyshev(rope[0], rope[len(rope)-1]); spread > stats.maxSpread {
+				stats.maxSpread = spread
+			}
+			if observer != nil {
+				observer.stepped(rope)
+			}
+		}
+		if observer != nil {
+			observer.moved(m, rope)
 		}
 	}
 
-	return len(visited)
+	return stats
+}
+
+func part1(moves []Move) int {
+	return len(simulate(moves, 2, 1, nil).visited[1])
+}
+
+func part2(moves []Move) int {
+	return len(simulate(moves, 10, 1, nil).visited[9])
 }
 
 func main() {
+	knots := flag.Int("knots", 0, "also simulate a rope with this many knots")
+	slack := flag.Int("slack", 1, "distance a knot may lag behind before following")
+	svgPath := flag.String("svg", "", "write the head and tail trails to this SVG file")
+	animate := flag.Bool("animate", false, "print the rope after every move")
+	flag.Parse()
+
 	rawContent, err := os.ReadFile("data.txt")
 	if err != nil {
 		log.Fatal(err)
@@ -152,11 +312,38 @@ func main() {
 	content := string(rawContent)
 	lines := strings.Split(content, "\n")
 
-	moves := make([]Move, len(lines))
+	moves := make([]Move, 0, len(lines))
 	for i, l := range lines {
-		moves[i] = parse(l)
+		if l == "" {
+			continue
+		}
+		moves, err = parse(l, moves)
+		if err != nil {
+			log.Fatalf("line %v: %v", i+1, err)
+		}
 	}
 
 	fmt.Println("Part 1: ", part1(moves))
 	fmt.Println("Part 2: ", part2(moves))
+
+	if *knots > 0 {
+		stats := simulate(moves, *knots, *slack, nil)
+		for i, visited := range stats.visited {
+			fmt.Printf("Knot %v visited %v positions\n", i, len(visited))
+		}
+		fmt.Println("Max spread: ", stats.maxSpread)
+	}
+
+	ropeKnots := *knots
+	if ropeKnots <= 0 {
+		ropeKnots = 10
+	}
+	if *svgPath != "" {
+		if err := writeSVG(*svgPath, moves, ropeKnots, *slack); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *animate {
+		animateRope(os.Stdout, moves, ropeKnots, *slack)
+	}
 }
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+func (m Move) String() string {
+	for name, dir := range directionNames {
+		if dir == m.dir {
+			return fmt.Sprintf("%v %v", name, m.length)
+		}
+	}
+	return fmt.Sprintf("? %v", m.length)
+}
+
+type Bounds struct {
+	minX int
+	minY int
+	maxX int
+	maxY int
+}
+
+func (b *Bounds) extend(p Pos) {
+	if p.x < b.minX {
+		b.minX = p.x
+	}
+	if p.y < b.minY {
+		b.minY = p.y
+	}
+	if p.x > b.maxX {
+		b.maxX = p.x
+	}
+	if p.y > b.maxY {
+		b.maxY = p.y
+	}
+}
+
+// TrailRecorder keeps the path of the head and the tail. Ropes are drawn from
+// above, so z is ignored.
+type TrailRecorder struct {
+	head   []Pos
+	tail   []Pos
+	bounds Bounds
+}
+
+func (t *TrailRecorder) stepped(rope []Pos) {
+	head, tail := rope[0], rope[len(rope)-1]
+	t.head = append(t.head, head)
+	if len(t.tail) == 0 || t.tail[len(t.tail)-1] != tail {
+		t.tail = append(t.tail, tail)
+	}
+	t.bounds.extend(head)
+	t.bounds.extend(tail)
+}
+
+func (t *TrailRecorder) moved(m Move, rope []Pos) {}
+
+const svgCell = 10
+
+func svgPoints(trail []Pos, b Bounds) string {
+	points := make([]string, len(trail))
+	for i, p := range trail {
+		x := (p.x-b.minX)*svgCell + svgCell/2
+		y := (b.maxY-p.y)*svgCell + svgCell/2
+		points[i] = fmt.Sprintf("%v,%v", x, y)
+	}
+	return strings.Join(points, " ")
+}
+
+func renderSVG(w io.Writer, moves []Move, knots, slack int) error {
+	trails := TrailRecorder{
+		head: []Pos{{}},
+		tail: []Pos{{}},
+	}
+	stats := simulate(moves, knots, slack, &trails)
+	b := trails.bounds
+
+	bw := bufio.NewWriter(w)
+	width, height := (b.maxX-b.minX+1)*svgCell, (b.maxY-b.minY+1)*svgCell
+	fmt.Fprintf(bw, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%v\" height=\"%v\" viewBox=\"0 0 %v %v\">\n", width, height, width, height)
+	fmt.Fprintf(bw, "  <rect width=\"%v\" height=\"%v\" fill=\"white\"/>\n", width, height)
+
+	cells := make([]Pos, 0, len(stats.visited[knots-1]))
+	for p := range stats.visited[knots-1] {
+		cells = append(cells, p)
+	}
+	sort.Slice(cells, func(i, j int) bool {
+		if cells[i].y != cells[j].y {
+			return cells[i].y > cells[j].y
+		}
+		return cells[i].x < cells[j].x
+	})
+
+	fmt.Fprintln(bw, "  <g fill=\"#9ecae1\">")
+	for _, p := range cells {
+		fmt.Fprintf(bw, "    <rect x=\"%v\" y=\"%v\" width=\"%v\" height=\"%v\"/>\n", (p.x-b.minX)*svgCell, (b.maxY-p.y)*svgCell, svgCell, svgCell)
+	}
+	fmt.Fprintln(bw, "  </g>")
+
+	fmt.Fprintf(bw, "  <polyline fill=\"none\" stroke=\"#d62728\" stroke-width=\"1\" points=\"%v\"/>\n", svgPoints(trails.head, b))
+	fmt.Fprintf(bw, "  <polyline fill=\"none\" stroke=\"#08519c\" stroke-width=\"2\" points=\"%v\"/>\n", svgPoints(trails.tail, b))
+	fmt.Fprintln(bw, "</svg>")
+
+	return bw.Flush()
+}
+
+func writeSVG(path string, moves []Move, knots, slack int) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	err = renderSVG(file, moves, knots, slack)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// FramePrinter draws the rope after every move the way the puzzle does: H
+// for the head, T for the tail, numbers for the knots in between and s for
+// the start. Knots that overlap show the one closer to the head.
+type FramePrinter struct {
+	w      io.Writer
+	bounds Bounds
+}
+
+func knotLabel(i, knots int) byte {
+	if i == 0 {
+		return 'H'
+	} else if i == knots-1 {
+		return 'T'
+	}
+	return strconv.Itoa(i % 10)[0]
+}
+
+func (f *FramePrinter) stepped(rope []Pos) {}
+
+func (f *FramePrinter) moved(m Move, rope []Pos) {
+	b := f.bounds
+	width := b.maxX - b.minX + 1
+	grid := make([][]byte, b.maxY-b.minY+1)
+	for i := range grid {
+		grid[i] = []byte(strings.Repeat(".", width))
+	}
+
+	grid[b.maxY][-b.minX] = 's'
+	for i := len(rope) - 1; i >= 0; i-- {
+		grid[b.maxY-rope[i].y][rope[i].x-b.minX] = knotLabel(i, len(rope))
+	}
+
+	fmt.Fprintf(f.w, "== %v ==\n\n", m)
+	for _, row := range grid {
+		fmt.Fprintln(f.w, string(row))
+	}
+	fmt.Fprintln(f.w)
+}
+
+func animateRope(w io.Writer, moves []Move, knots, slack int) {
+	var bounds Bounds
+	for _, visited := range simulate(moves, knots, slack, nil).visited {
+		for p := range visited {
+			bounds.extend(p)
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	simulate(moves, knots, slack, &FramePrinter{w: bw, bounds: bounds})
+	bw.Flush()
+}